@@ -3,26 +3,61 @@ package configs
 import (
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 const (
 	defaultConfigFile = "config.yaml"
+	defaultLimit      = 3
+	defaultChunkSize  = 1000
+	defaultOutput     = "text"
+
+	defaultSchemaDiffFile = "schemadiff.sql"
+	defaultDataDiffFile   = "datadiff.sql"
+	defaultSyncBatchSize  = 100
+	defaultParallelism    = 1
 )
 
 // Conf holds all the necessary information for running the comparison.
 type Conf struct {
-	Database1          *Database       `yaml:"database"`
-	Database2          *Database       `yaml:"database2"`
-	Dir                string          `yaml:"dir"`
-	Dir2               string          `yaml:"dir2"`
-	IgnoreTables       []string        `yaml:"ignore_tables"`
-	IgnoreColumns      []string        `yaml:"ignore_columns"`
-	IgnoreTableColumns []*TableColumns `yaml:"ignore_table_columns"`
-	IgnoreTypes        []string        `yaml:"ignore_types"`
-	Limit              int             `yaml:"limit"`
-	Detailed           bool            `yaml:"detailed"`
+	Database1          *Database          `yaml:"database"`
+	Database2          *Database          `yaml:"database2"`
+	Dir                string             `yaml:"dir"`
+	Dir2               string             `yaml:"dir2"`
+	IgnoreTables       []string           `yaml:"ignore_tables"`
+	IgnoreColumns      []string           `yaml:"ignore_columns"`
+	IgnoreTableColumns []*TableColumns    `yaml:"ignore_table_columns"`
+	IgnoreTypes        []string           `yaml:"ignore_types"`
+	TableKeys          []*TableColumns    `yaml:"table_keys"`
+	Where              string             `yaml:"where"`
+	Where2             string             `yaml:"where2"`
+	TableFilters       []*TableFilter     `yaml:"table_filters"`
+	TableMappings      []*TableMapping    `yaml:"table_mappings"`
+	ColumnMappings     []*ColumnMapping   `yaml:"column_mappings"`
+	Tolerance          *Tolerance         `yaml:"tolerance"`
+	ColumnTolerances   []*ColumnTolerance `yaml:"column_tolerances"`
+	TimeZone           string             `yaml:"time_zone"`
+	IgnoreJSONPaths    []*JSONPaths       `yaml:"ignore_json_paths"`
+	Limit              int                `yaml:"limit"`
+	Detailed           bool               `yaml:"detailed"`
+	Output             string             `yaml:"output"`
+	Checksum           bool               `yaml:"checksum"`
+	ChunkSize          int                `yaml:"chunk_size"`
+	DataOnly           bool               `yaml:"data_only"`
+	SchemaDiffFile     string             `yaml:"schemadiff_file"`
+	DataDiffFile       string             `yaml:"datadiff_file"`
+	SyncBatchSize      int                `yaml:"sync_batch_size"`
+	SyncMaxChanges     int                `yaml:"sync_max_changes"`
+	Parallelism        int                `yaml:"parallelism"`
+	SnapshotPosition   bool               `yaml:"snapshot_position"`
+
+	// SyncApply and SyncAssumeYes are set from the command line: strategy sync only applies the
+	// changes if SyncApply is true, asking for confirmation unless SyncAssumeYes is true.
+	SyncApply     bool `yaml:"-"`
+	SyncAssumeYes bool `yaml:"-"`
 
 	// These fields are handled when reading the config file and will be used
 	// to know wich tables, columns and types are to be ignored during comparison.
@@ -30,15 +65,42 @@ type Conf struct {
 	ignoreTableMap       map[string]bool
 	ignoreColumnMap      map[string]bool
 	ignoreTableColumnMap map[string]map[string]bool
+
+	// tableKeyMap holds the columns to be used for matching the rows of each table.
+	tableKeyMap map[string][]string
+	// tableFilterMap holds the condition the rows of each table must match to be compared.
+	// tableFilterMap2 holds the condition for the rows of each table of database2, if it is a different one.
+	tableFilterMap  map[string]string
+	tableFilterMap2 map[string]string
+
+	// These fields are handled when reading the config file and will be used to pair the
+	// tables and columns named differently in both databases, in both directions.
+	tableNameMap2  map[string]string
+	tableNameMap1  map[string]string
+	columnNameMap2 map[string]map[string]string
+	columnNameMap1 map[string]map[string]string
+
+	// toleranceMap holds the tolerance of each table (for the column "") and of each column.
+	toleranceMap map[string]map[string]*Tolerance
+	// ignoreJSONPathMap holds the paths left out of the documents of each JSON column of each table.
+	ignoreJSONPathMap map[string]map[string][]string
 }
 
 type Database struct {
 	Label    string `yaml:"label"`
+	Driver   string `yaml:"driver"` // mysql (default), postgres or sqlite
 	Host     string `yaml:"host"`
 	Port     string `yaml:"port"`
 	Database string `yaml:"database"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+
+	// PostgreSQL only
+	Schema  string `yaml:"schema"`  // schema holding the tables, public by default
+	SSLMode string `yaml:"sslmode"` // e.g. disable, require, verify-full
+
+	// SQLite only
+	Path string `yaml:"path"` // path to the database file
 }
 
 type TableColumns struct {
@@ -46,6 +108,51 @@ type TableColumns struct {
 	Columns   []string `yaml:"columns"`
 }
 
+// TableMapping pairs a table of database with a table named differently in database2.
+type TableMapping struct {
+	TableName  string `yaml:"table_name"`
+	TableName2 string `yaml:"table_name2"`
+}
+
+// ColumnMapping pairs a column of a table of database with a column named differently in database2.
+// The table is named as in database.
+type ColumnMapping struct {
+	TableName string `yaml:"table_name"`
+	Column    string `yaml:"column"`
+	Column2   string `yaml:"column2"`
+}
+
+// Tolerance holds how much two numeric values can differ and still be considered equal:
+// by at most Absolute, or by at most Relative times the largest of them in absolute value.
+// Dates and times are considered equal if they are at most Time apart.
+type Tolerance struct {
+	Absolute float64       `yaml:"absolute"`
+	Relative float64       `yaml:"relative"`
+	Time     time.Duration `yaml:"time"` // e.g. 2s or 500ms
+}
+
+// ColumnTolerance holds the tolerance of a column of a table, or of every numeric or temporal column of the table
+// if Column is empty. The table and the column are named as in database.
+type ColumnTolerance struct {
+	TableName string `yaml:"table_name"`
+	Column    string `yaml:"column"`
+	Tolerance `yaml:",inline"`
+}
+
+// JSONPaths holds paths inside the documents of a JSON column of a table, e.g. $.updated_at.
+// The table and the column are named as in database.
+type JSONPaths struct {
+	TableName string   `yaml:"table_name"`
+	Column    string   `yaml:"column"`
+	Paths     []string `yaml:"paths"`
+}
+
+type TableFilter struct {
+	TableName string `yaml:"table_name"`
+	Where     string `yaml:"where"`  // SQL condition, as written after WHERE
+	Where2    string `yaml:"where2"` // condition for database2 if different, e.g. when its columns are renamed
+}
+
 // GetConf returns the config struct from the given yaml file.
 // GetConf will also handle the tables, columns and types to be ignored, populating
 // the correspondent fields.
@@ -92,6 +199,77 @@ func GetConf(configFile string) (*Conf, error) {
 		c.ignoreTypeMap[t] = true
 	}
 
+	c.tableKeyMap = make(map[string][]string)
+	for _, t := range c.TableKeys {
+		c.tableKeyMap[t.TableName] = t.Columns
+	}
+
+	c.tableFilterMap = make(map[string]string)
+	for _, t := range c.TableFilters {
+		c.tableFilterMap[t.TableName] = t.Where
+	}
+	c.tableFilterMap2 = make(map[string]string)
+	for _, t := range c.TableFilters {
+		if t.Where2 != "" {
+			c.tableFilterMap2[t.TableName] = t.Where2
+		}
+	}
+
+	c.tableNameMap2 = make(map[string]string)
+	c.tableNameMap1 = make(map[string]string)
+	for _, t := range c.TableMappings {
+		c.tableNameMap2[t.TableName] = t.TableName2
+		c.tableNameMap1[t.TableName2] = t.TableName
+	}
+
+	c.columnNameMap2 = make(map[string]map[string]string)
+	c.columnNameMap1 = make(map[string]map[string]string)
+	for _, m := range c.ColumnMappings {
+		if c.columnNameMap2[m.TableName] == nil {
+			c.columnNameMap2[m.TableName] = make(map[string]string)
+			c.columnNameMap1[m.TableName] = make(map[string]string)
+		}
+		c.columnNameMap2[m.TableName][m.Column] = m.Column2
+		c.columnNameMap1[m.TableName][m.Column2] = m.Column
+	}
+
+	// A filter using a column renamed in database2 would fail there, so it must be given for database2 too
+	for table, columns := range c.columnNameMap2 {
+		where := c.GetTableFilter(table)
+		if where == "" || where != c.GetTableFilter2(table) {
+			continue
+		}
+		for column := range columns {
+			if usesColumn(where, column) {
+				return nil, fmt.Errorf("filter of table %s uses column %s, which is renamed in database2: "+
+					"set the filter for database2 with where2", table, column)
+			}
+		}
+	}
+
+	c.toleranceMap = make(map[string]map[string]*Tolerance)
+	for _, t := range c.ColumnTolerances {
+		if t.Absolute < 0 || t.Relative < 0 || t.Time < 0 {
+			return nil, fmt.Errorf("tolerance of table %s can't be negative", t.TableName)
+		}
+		if c.toleranceMap[t.TableName] == nil {
+			c.toleranceMap[t.TableName] = make(map[string]*Tolerance)
+		}
+		c.toleranceMap[t.TableName][t.Column] = &t.Tolerance
+	}
+
+	c.ignoreJSONPathMap = make(map[string]map[string][]string)
+	for _, p := range c.IgnoreJSONPaths {
+		if c.ignoreJSONPathMap[p.TableName] == nil {
+			c.ignoreJSONPathMap[p.TableName] = make(map[string][]string)
+		}
+		c.ignoreJSONPathMap[p.TableName][p.Column] = append(c.ignoreJSONPathMap[p.TableName][p.Column], p.Paths...)
+	}
+
+	if c.Tolerance != nil && (c.Tolerance.Absolute < 0 || c.Tolerance.Relative < 0 || c.Tolerance.Time < 0) {
+		return nil, fmt.Errorf("tolerance can't be negative")
+	}
+
 	return c, nil
 }
 
@@ -111,3 +289,161 @@ func (c Conf) IsColumnToBeIgnored(table, column string) bool {
 func (c Conf) IsTypeToBeIgnored(t string) bool {
 	return c.ignoreTypeMap[t]
 }
+
+// GetTableKey returns the columns configured for matching the rows of given table.
+// Returns nil if no key was configured for the table.
+func (c Conf) GetTableKey(table string) []string {
+	return c.tableKeyMap[table]
+}
+
+// GetTableFilter returns the condition the rows of given table must match to be compared or dumped.
+// The condition configured for the table is used if there is one (even if empty), Where otherwise.
+// Returns an empty string if the rows are not filtered.
+func (c Conf) GetTableFilter(table string) string {
+	if where, ok := c.tableFilterMap[table]; ok {
+		return where
+	}
+	return c.Where
+}
+
+// GetTableFilter2 returns the condition the rows of given table of database2 must match to be compared,
+// written with the column names of database2. The table is named as in database. The condition configured for database2 with Where2 is used if there is one,
+// the one returned by GetTableFilter otherwise.
+func (c Conf) GetTableFilter2(table string) string {
+	if _, ok := c.tableFilterMap[table]; ok {
+		if where, ok := c.tableFilterMap2[table]; ok {
+			return where
+		}
+		return c.tableFilterMap[table]
+	}
+	if c.Where2 != "" {
+		return c.Where2
+	}
+	return c.Where
+}
+
+// usesColumn returns whether given condition holds given column name as a whole word.
+func usesColumn(where, column string) bool {
+	return regexp.MustCompile(`(^|[^\w$])` + regexp.QuoteMeta(column) + `($|[^\w$])`).MatchString(where)
+}
+
+// GetTableName2 returns the name in database2 of given table of database, the same name if it is not mapped.
+func (c Conf) GetTableName2(table string) string {
+	if name, ok := c.tableNameMap2[table]; ok {
+		return name
+	}
+	return table
+}
+
+// GetTableName1 returns the name in database of given table of database2, the same name if it is not mapped.
+// Every other setting of a table (e.g. the columns to ignore) uses the name in database.
+func (c Conf) GetTableName1(table2 string) string {
+	if name, ok := c.tableNameMap1[table2]; ok {
+		return name
+	}
+	return table2
+}
+
+// GetColumnName2 returns the name in database2 of given column of given table of database, the same name if it is not mapped.
+func (c Conf) GetColumnName2(table, column string) string {
+	if name, ok := c.columnNameMap2[table][column]; ok {
+		return name
+	}
+	return column
+}
+
+// GetColumnName1 returns the name in database of given column of database2, the same name if it is not mapped.
+// The table is named as in database.
+func (c Conf) GetColumnName1(table, column2 string) string {
+	if name, ok := c.columnNameMap1[table][column2]; ok {
+		return name
+	}
+	return column2
+}
+
+// GetTolerance returns how much the values of given column of given table can differ and still be
+// considered equal. The tolerance configured for the column is used if there is one, the one configured for
+// the table otherwise, and Tolerance if neither is. Returns nil if values must be exactly the same,
+// as when the tolerance is zero.
+func (c Conf) GetTolerance(table, column string) *Tolerance {
+	t, ok := c.toleranceMap[table][column]
+	if !ok {
+		t, ok = c.toleranceMap[table][""]
+	}
+	if !ok {
+		t = c.Tolerance
+	}
+	if t == nil || (t.Absolute == 0 && t.Relative == 0 && t.Time == 0) {
+		return nil
+	}
+	return t
+}
+
+// GetIgnoredJSONPaths returns the paths left out of the documents of given JSON column of given table
+// when comparing them. Returns nil if the whole documents are compared.
+func (c Conf) GetIgnoredJSONPaths(table, column string) []string {
+	return c.ignoreJSONPathMap[table][column]
+}
+
+// GetLimit returns the number of differences to show for each table.
+// If no limit was configured, defaultLimit is returned.
+func (c Conf) GetLimit() int {
+	if c.Limit <= 0 {
+		return defaultLimit
+	}
+	return c.Limit
+}
+
+// GetChunkSize returns the number of rows of each chunk when comparing checksums.
+// If no chunk size was configured, defaultChunkSize is returned.
+func (c Conf) GetChunkSize() int {
+	if c.ChunkSize <= 0 {
+		return defaultChunkSize
+	}
+	return c.ChunkSize
+}
+
+// GetSchemaDiffFile returns the file where the schema migration is written when the output is schemadiff.
+// If no file was configured, defaultSchemaDiffFile is returned.
+func (c Conf) GetSchemaDiffFile() string {
+	if c.SchemaDiffFile == "" {
+		return defaultSchemaDiffFile
+	}
+	return c.SchemaDiffFile
+}
+
+// GetDataDiffFile returns the file where the data patch is written when the output is datadiff.
+// If no file was configured, defaultDataDiffFile is returned.
+func (c Conf) GetDataDiffFile() string {
+	if c.DataDiffFile == "" {
+		return defaultDataDiffFile
+	}
+	return c.DataDiffFile
+}
+
+// GetSyncBatchSize returns the number of statements sent at once when applying the changes of strategy sync.
+// If no batch size was configured, defaultSyncBatchSize is returned.
+func (c Conf) GetSyncBatchSize() int {
+	if c.SyncBatchSize <= 0 {
+		return defaultSyncBatchSize
+	}
+	return c.SyncBatchSize
+}
+
+// GetParallelism returns the number of tables compared or dumped at once.
+// If no parallelism was configured, defaultParallelism is returned.
+func (c Conf) GetParallelism() int {
+	if c.Parallelism <= 0 {
+		return defaultParallelism
+	}
+	return c.Parallelism
+}
+
+// GetOutput returns the format in which the differences are shown.
+// If no output was configured, defaultOutput is returned.
+func (c Conf) GetOutput() string {
+	if c.Output == "" {
+		return defaultOutput
+	}
+	return c.Output
+}
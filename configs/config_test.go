@@ -0,0 +1,101 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getTestConf returns the config read from a file holding given yaml.
+func getTestConf(t *testing.T, yaml string) (*Conf, error) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configFile, []byte(yaml), 0644)
+	assert.NoError(t, err, "error writing config: %v", err)
+	return GetConf(configFile)
+}
+
+func TestGetTableFilter2(t *testing.T) {
+	c, err := getTestConf(t, `
+where: tenant_id = 42
+table_filters:
+  - table_name: clients
+    where: name <> 'z'
+    where2: full_name <> 'z'
+  - table_name: tags
+    where: code <> 'x'
+column_mappings:
+  - table_name: clients
+    column: name
+    column2: full_name
+`)
+	assert.NoError(t, err, "error creating config: %v", err)
+
+	assert.EqualValues(t, "name <> 'z'", c.GetTableFilter("clients"))
+	assert.EqualValues(t, "full_name <> 'z'", c.GetTableFilter2("clients"))
+	assert.EqualValues(t, "code <> 'x'", c.GetTableFilter2("tags"))
+	assert.EqualValues(t, "tenant_id = 42", c.GetTableFilter2("users"))
+}
+
+func TestGetConfRenamedColumnFilter(t *testing.T) {
+	mappings := `
+column_mappings:
+  - table_name: clients
+    column: name
+    column2: full_name
+`
+	// The filter would fail in database2, where the column is named full_name
+	_, err := getTestConf(t, mappings+"where: `name` <> 'z'\n")
+	assert.Error(t, err)
+	_, err = getTestConf(t, mappings+`
+table_filters:
+  - table_name: clients
+    where: name <> 'z'
+`)
+	assert.Error(t, err)
+
+	// Columns whose name only contains the renamed one, and filters given for database2, are fine
+	_, err = getTestConf(t, mappings+"where: surname <> 'z'\n")
+	assert.NoError(t, err)
+	_, err = getTestConf(t, mappings+"where: name <> 'z'\nwhere2: full_name <> 'z'\n")
+	assert.NoError(t, err)
+}
+
+func TestGetTolerance(t *testing.T) {
+	c, err := getTestConf(t, `
+tolerance:
+  absolute: 0.001
+column_tolerances:
+  - table_name: metrics
+    relative: 0.01
+  - table_name: metrics
+    column: exact
+    absolute: 0
+  - table_name: metrics
+    column: ratio
+    absolute: 0.5
+`)
+	assert.NoError(t, err, "error creating config: %v", err)
+
+	assert.EqualValues(t, &Tolerance{Absolute: 0.5}, c.GetTolerance("metrics", "ratio"))
+	assert.EqualValues(t, &Tolerance{Relative: 0.01}, c.GetTolerance("metrics", "value"))
+	assert.EqualValues(t, &Tolerance{Absolute: 0.001}, c.GetTolerance("users", "value"))
+	// A zero tolerance compares values exactly, also overriding the rest
+	assert.Nil(t, c.GetTolerance("metrics", "exact"))
+
+	c, err = getTestConf(t, "limit: 1\n")
+	assert.NoError(t, err, "error creating config: %v", err)
+	assert.Nil(t, c.GetTolerance("metrics", "value"))
+}
+
+func TestGetConfNegativeTolerance(t *testing.T) {
+	for _, yaml := range []string{
+		"tolerance:\n  absolute: -1\n",
+		"tolerance:\n  relative: -0.1\n",
+		"column_tolerances:\n  - table_name: metrics\n    absolute: -1\n",
+	} {
+		_, err := getTestConf(t, yaml)
+		assert.Error(t, err, yaml)
+	}
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	stmtGetChunkKeys     = "SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT %d"
+	stmtGetChunkChecksum = "SELECT COUNT(*), %s FROM %s WHERE %s"
+)
+
+// keyChunk holds a range of keys of a table. Keys are ranged in the order of the key columns themselves, so the
+// key index can be used to find them (see getChunkUpperBound). Key columns must therefore be ordered the same
+// way by both databases, e.g. have the same collation.
+type keyChunk struct {
+	// lower holds the key where the chunk starts (exclusive), nil if the chunk starts at the first key.
+	lower []*string
+	// upper holds the key where the chunk ends (inclusive), nil if the chunk ends at the last key.
+	upper []*string
+	// nulls is true if the chunk holds the rows where any key column is null instead of a range of keys.
+	nulls bool
+}
+
+// chunkChecksum holds the number of rows and the checksum of a chunk.
+type chunkChecksum struct {
+	count    int
+	checksum string
+}
+
+// compareTableChecksums compares the data of given table splitting it into chunks of keys.
+//
+// The checksum of each chunk is computed by both databases and only the chunks whose checksums
+// don't match are fetched and compared row by row. Chunks are computed using the keys of database1,
+// the last chunk has no upper bound so that rows only existing in database2 are also compared.
+// Only the rows matching the condition configured for the table in each database are compared.
+// Both tables must have the same name and columns.
+func compareTableChecksums(ctx context.Context, db1 *databaseConn, db2 *databaseConn, t1, t2 tableData,
+	tableResult *tableDifferences) error {
+	chunkSize := getConfigFromContext(ctx).GetChunkSize()
+
+	// Rows with null key values can't be found through ranges of keys, compare them in their own chunk
+	if err := compareChunk(ctx, db1, db2, t1, t2, keyChunk{nulls: true}, tableResult); err != nil {
+		return err
+	}
+
+	var lower []*string
+	for {
+		upper, err := getChunkUpperBound(ctx, db1, t1, lower, chunkSize)
+		if err != nil {
+			return err
+		}
+
+		chunk := keyChunk{lower: lower, upper: upper}
+		if err := compareChunk(ctx, db1, db2, t1, t2, chunk, tableResult); err != nil {
+			return err
+		}
+
+		if upper == nil {
+			return nil
+		}
+		lower = upper
+	}
+}
+
+// compareChunk compares the checksums of given chunk in both databases. If they don't match,
+// the rows of the chunk are compared, registering the differences in tableResult.
+func compareChunk(ctx context.Context, db1 *databaseConn, db2 *databaseConn, t1, t2 tableData, chunk keyChunk,
+	tableResult *tableDifferences) error {
+	filter, args := chunk.filter(db1.engine, t1.key)
+
+	checksum1, err := getChunkChecksum(ctx, db1, t1.name, t1.columns, combineFilters(t1.where, filter), args)
+	if err != nil {
+		return err
+	}
+	checksum2, err := getChunkChecksum(ctx, db2, t2.name, t2.columns, combineFilters(t2.where, filter), args)
+	if err != nil {
+		return err
+	}
+
+	if checksum1 == checksum2 {
+		tableResult.Rows1 += checksum1.count
+		tableResult.Rows2 += checksum2.count
+		return nil
+	}
+
+	return compareTableRows(ctx, db1, db2, t1, t2, tableResult, filter, args...)
+}
+
+// getChunkUpperBound returns the key of the row that is chunkSize rows after lower (or after the
+// first key if lower is nil). Returns nil if there are not enough rows, meaning the chunk is the last one.
+// The keys of the chunk are read walking the key index from lower, instead of skipping rows with an offset.
+func getChunkUpperBound(ctx context.Context, db *databaseConn, t tableData, lower []*string, chunkSize int) ([]*string, error) {
+	keyColumns := make([]string, 0, len(t.key))
+	orderColumns := make([]string, 0, len(t.key))
+	for _, k := range t.key {
+		keyColumns = append(keyColumns, db.engine.selectExpression(findColumn(t.columns, k)))
+		orderColumns = append(orderColumns, db.engine.quote(k))
+	}
+
+	filter, args := keyChunk{lower: lower}.filter(db.engine, t.key)
+	query := fmt.Sprintf(stmtGetChunkKeys, strings.Join(keyColumns, ", "), db.engine.quote(t.name),
+		combineFilters(t.where, filter), strings.Join(orderColumns, ", "), chunkSize)
+
+	rows, err := db.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	src := &sqlRowSource{rows: rows, columns: len(t.key)}
+	var upper []*string
+	for n := 0; n < chunkSize; n++ {
+		key, err := src.next()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, nil
+		}
+		upper = key
+	}
+	return upper, nil
+}
+
+// getChunkChecksum returns the number of rows and the checksum of the rows matching given filter.
+func getChunkChecksum(ctx context.Context, db *databaseConn, table string, columns []tableColumn,
+	filter string, args []interface{}) (chunkChecksum, error) {
+	query := fmt.Sprintf(stmtGetChunkChecksum, db.engine.checksumExpression(columns), db.engine.quote(table), filter)
+
+	var checksum chunkChecksum
+	var value sql.NullString
+	if err := db.tx.QueryRowContext(ctx, query, args...).Scan(&checksum.count, &value); err != nil {
+		return chunkChecksum{}, err
+	}
+	checksum.checksum = value.String
+
+	return checksum, nil
+}
+
+// filter returns the condition matching the rows of the chunk and its arguments.
+func (c keyChunk) filter(e engine, key []string) (string, []interface{}) {
+	nulls := make([]string, 0, len(key))
+	keyColumns := make([]string, 0, len(key))
+	for _, k := range key {
+		nulls = append(nulls, fmt.Sprintf("%s IS NULL", e.quote(k)))
+		keyColumns = append(keyColumns, e.quote(k))
+	}
+
+	if c.nulls {
+		return fmt.Sprintf("(%s)", strings.Join(nulls, " OR ")), nil
+	}
+
+	conditions := []string{fmt.Sprintf("NOT (%s)", strings.Join(nulls, " OR "))}
+	var args []interface{}
+	for _, bound := range []struct {
+		values   []*string
+		operator string
+	}{{c.lower, ">"}, {c.upper, "<="}} {
+		if bound.values == nil {
+			continue
+		}
+
+		placeholders := make([]string, 0, len(key))
+		for _, v := range bound.values {
+			args = append(args, *v)
+			placeholders = append(placeholders, e.placeholder(len(args)))
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s) %s (%s)",
+			strings.Join(keyColumns, ", "), bound.operator, strings.Join(placeholders, ", ")))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"go-db-compare/configs"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyChunkFilter(t *testing.T) {
+	key := []string{"id", "code"}
+	lower1, lower2, upper1, upper2 := "1", "a", "5", "b"
+
+	filter, args := keyChunk{nulls: true}.filter(mysqlEngine{}, key)
+	assert.EqualValues(t, "(`id` IS NULL OR `code` IS NULL)", filter)
+	assert.Empty(t, args)
+
+	filter, args = keyChunk{upper: []*string{&upper1, &upper2}}.filter(mysqlEngine{}, key)
+	assert.EqualValues(t, "NOT (`id` IS NULL OR `code` IS NULL) AND (`id`, `code`) <= (?, ?)", filter)
+	assert.EqualValues(t, []interface{}{"5", "b"}, args)
+
+	filter, args = keyChunk{lower: []*string{&lower1, &lower2}}.filter(mysqlEngine{}, key)
+	assert.EqualValues(t, "NOT (`id` IS NULL OR `code` IS NULL) AND (`id`, `code`) > (?, ?)", filter)
+	assert.EqualValues(t, []interface{}{"1", "a"}, args)
+}
+
+func TestCompareTableChecksums(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.ChunkSize = 2
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	conn1, mock1, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+	conn2, mock2, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+
+	mock1.ExpectBegin()
+	conn1.tx, err = conn1.connection.BeginTx(ctx, &sql.TxOptions{})
+	assert.NoError(t, err, "error creating database transaction: %v", err)
+	mock2.ExpectBegin()
+	conn2.tx, err = conn2.connection.BeginTx(ctx, &sql.TxOptions{})
+	assert.NoError(t, err, "error creating database transaction: %v", err)
+
+	columns := []tableColumn{{Name: "id", DataType: "int"}, {Name: "name", DataType: "varchar"}}
+	key := []string{"id"}
+	checksumColumns := []string{"COUNT(*)", "checksum"}
+
+	// Chunk of null keys, equal in both databases
+	for _, mock := range []sqlmock.Sqlmock{mock1, mock2} {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM `tableName` WHERE (`id` IS NULL)")).
+			WillReturnRows(sqlmock.NewRows(checksumColumns).AddRow(0, "0"))
+	}
+
+	// First chunk, equal in both databases
+	mock1.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `tableName` WHERE NOT (`id` IS NULL) ORDER BY `id` LIMIT 2")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1").AddRow("2"))
+	for _, mock := range []sqlmock.Sqlmock{mock1, mock2} {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM `tableName` WHERE NOT (`id` IS NULL) AND (`id`) <= (?)")).
+			WithArgs("2").
+			WillReturnRows(sqlmock.NewRows(checksumColumns).AddRow(2, "123"))
+	}
+
+	// Last chunk, different in both databases
+	mock1.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `tableName` WHERE NOT (`id` IS NULL) AND (`id`) > (?) ORDER BY `id` LIMIT 2")).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("3"))
+	mock1.ExpectQuery(regexp.QuoteMeta("FROM `tableName` WHERE NOT (`id` IS NULL) AND (`id`) > (?)")).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows(checksumColumns).AddRow(1, "456"))
+	mock2.ExpectQuery(regexp.QuoteMeta("FROM `tableName` WHERE NOT (`id` IS NULL) AND (`id`) > (?)")).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows(checksumColumns).AddRow(1, "789"))
+
+	query := regexp.QuoteMeta("SELECT `id`, `name` FROM `tableName` WHERE NOT (`id` IS NULL) AND (`id`) > (?) ORDER BY `id`")
+	mock1.ExpectQuery(query).WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "a"))
+	mock2.ExpectQuery(query).WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "b"))
+
+	tableResult := &tableDifferences{Table: "tableName"}
+	table := tableData{name: "tableName", columns: columns, key: key}
+	err = compareTableChecksums(ctx, conn1, conn2, table, table, tableResult)
+	assert.NoError(t, err, "error comparing checksums: %v", err)
+
+	assert.NoError(t, mock1.ExpectationsWereMet())
+	assert.NoError(t, mock2.ExpectationsWereMet())
+	assert.EqualValues(t, 3, tableResult.Rows1)
+	assert.EqualValues(t, 3, tableResult.Rows2)
+	assert.EqualValues(t, 1, tableResult.Changed)
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("id", "3"), Values: []valueDifference{{Column: "name", Value1: strPtr("a"), Value2: strPtr("b")}}},
+	}, tableResult.Rows)
+}
+
+func TestKeyChunkFilterPostgres(t *testing.T) {
+	key := []string{"id", "code"}
+	lower1, lower2, upper1, upper2 := "1", "a", "5", "b"
+
+	filter, args := keyChunk{lower: []*string{&lower1, &lower2}, upper: []*string{&upper1, &upper2}}.filter(postgresEngine{}, key)
+	assert.EqualValues(t, `NOT ("id" IS NULL OR "code" IS NULL) AND ("id", "code") > ($1, $2) AND ("id", "code") <= ($3, $4)`, filter)
+	assert.EqualValues(t, []interface{}{"1", "a", "5", "b"}, args)
+}
+
+func TestChunkChecksumSQLite(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE separators1 (a TEXT, b TEXT)",
+		"CREATE TABLE separators2 (a TEXT, b TEXT)",
+		"CREATE TABLE duplicates1 (a TEXT)",
+		"CREATE TABLE duplicates2 (a TEXT)",
+		"INSERT INTO separators1 VALUES ('x#', 'y')",
+		"INSERT INTO separators2 VALUES ('x', '#y')",
+		"INSERT INTO duplicates1 VALUES ('x'), ('x'), ('z')",
+		"INSERT INTO duplicates2 VALUES ('y'), ('y'), ('z')")
+	config.Database2 = config.Database1
+	ctx, db, _ := openTestDatabases(t, config)
+	assert.NoError(t, db.begin(ctx))
+
+	// Neither separators within values nor duplicated rows make different chunks share their checksum
+	for _, test := range []struct {
+		table1, table2 string
+		columns        []tableColumn
+	}{
+		{"separators1", "separators2", []tableColumn{{Name: "a", DataType: "text"}, {Name: "b", DataType: "text"}}},
+		{"duplicates1", "duplicates2", []tableColumn{{Name: "a", DataType: "text"}}},
+	} {
+		checksum1, err := getChunkChecksum(ctx, db, test.table1, test.columns, "1 = 1", nil)
+		assert.NoError(t, err, "error getting checksum: %v", err)
+		checksum2, err := getChunkChecksum(ctx, db, test.table2, test.columns, "1 = 1", nil)
+		assert.NoError(t, err, "error getting checksum: %v", err)
+		assert.EqualValues(t, checksum1.count, checksum2.count)
+		assert.NotEqualValues(t, checksum1.checksum, checksum2.checksum, "%s %s", test.table1, test.table2)
+	}
+}
@@ -4,11 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"os"
 	"time"
 
 	"go-db-compare/configs"
-
-	"github.com/go-sql-driver/mysql"
 )
 
 const (
@@ -16,25 +15,62 @@ const (
 	dbConnMaxIdleConns = 10
 )
 
+// dbTx is the transaction used to read a database. It is a *sql.Tx, unless the engine begins its
+// transactions with statements database/sql can't send (see mysqlEngine.beginSnapshot).
+type dbTx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	Commit() error
+	Rollback() error
+}
+
 type databaseConn struct {
 	connection *sql.DB
-	tx         *sql.Tx
+	tx         dbTx
+	engine     engine
+	// snapshots holds the transactions begun along with tx, reading its same snapshot, which are handed
+	// to the workers of engines that can't share snapshots (see begin and worker).
+	snapshots []dbTx
+	// pooled is true if the transaction of this worker comes from snapshots, so it is kept when released.
+	pooled bool
+	// position holds where the snapshot read by tx is in the log of the database (see engine.snapshotPosition).
+	// It is read by begin, only if configured with SnapshotPosition.
+	position string
+
+	config  *configs.Database
+	tables  []fullTable
+	schemas map[string]*tableSchema
 
-	config *mysql.Config
-	tables []fullTable
+	// patch receives the statements fixing the rows of this database that differ from the other
+	// database, nil if they are not written.
+	patch *dataPatch
+	// writable is true if the transaction begun by begin must allow writing (e.g. to apply a sync).
+	writable bool
+	// mapped is true if the tables and columns of this database may be named differently than in the
+	// config (see configs.Conf.GetTableName1), as for database2.
+	mapped bool
 }
 
 func openDatabaseConnection(ctx context.Context, dbConfig *configs.Database) (*databaseConn, error) {
-	// Initialize config
-	config := mysql.NewConfig()
-	config.User = dbConfig.Username
-	config.Passwd = dbConfig.Password
-	config.DBName = dbConfig.Database
-	config.Net = "tcp"
-	config.Addr = fmt.Sprintf("%s:%s", dbConfig.Host, dbConfig.Port)
+	return openConnection(ctx, dbConfig, false)
+}
+
+// openWritableDatabaseConnection opens a connection to given database whose transaction allows writing
+// (see databaseConn.writable).
+func openWritableDatabaseConnection(ctx context.Context, dbConfig *configs.Database) (*databaseConn, error) {
+	return openConnection(ctx, dbConfig, true)
+}
+
+func openConnection(ctx context.Context, dbConfig *configs.Database, writable bool) (*databaseConn, error) {
+	// Get the engine of the database
+	e, err := getEngine(dbConfig.Driver)
+	if err != nil {
+		return nil, err
+	}
 
 	// Open connection
-	db, err := sql.Open("mysql", config.FormatDSN())
+	db, err := sql.Open(e.driverName(), e.dataSourceName(dbConfig, writable))
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %v", err)
 	}
@@ -44,7 +80,8 @@ func openDatabaseConnection(ctx context.Context, dbConfig *configs.Database) (*d
 	db.SetMaxIdleConns(dbConnMaxIdleConns)
 
 	// Verify the connection
-	ctxWithTimeout, _ := context.WithTimeout(ctx, time.Second*5)
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
 	if err := db.PingContext(ctxWithTimeout); err != nil {
 		return nil, fmt.Errorf("pinging database: %v", err)
 	}
@@ -52,8 +89,188 @@ func openDatabaseConnection(ctx context.Context, dbConfig *configs.Database) (*d
 	// Initialize connection struct
 	d := &databaseConn{
 		connection: db,
-		config:     config,
+		engine:     e,
+		config:     dbConfig,
+		writable:   writable,
 	}
 
 	return d, nil
 }
+
+// namespace returns the namespace holding the tables of the database (see engine.namespace).
+func (db *databaseConn) namespace() string {
+	return db.engine.namespace(db.config)
+}
+
+// name returns the name of the database, used when reporting problems.
+func (db *databaseConn) name() string {
+	if db.config.Database == "" {
+		return db.config.Path
+	}
+	return db.config.Database
+}
+
+// getTableSchema returns the definition of given table (see engine.getTableSchema).
+// Definitions are only fetched once, so they can be used both to compare and to migrate schemas.
+func (db *databaseConn) getTableSchema(ctx context.Context, table fullTable) (*tableSchema, error) {
+	if schema, ok := db.schemas[table.Name]; ok {
+		return schema, nil
+	}
+
+	schema, err := db.engine.getTableSchema(ctx, db.tx, db.namespace(), table)
+	if err != nil {
+		return nil, err
+	}
+	if db.schemas == nil {
+		db.schemas = make(map[string]*tableSchema)
+	}
+	db.schemas[table.Name] = schema
+
+	return schema, nil
+}
+
+// begin begins the transaction used to read the database, reading a consistent snapshot of every table
+// (see engine.beginSnapshot). The transaction is read-only unless the database is writable.
+//
+// If tables are handled at once (see forEachTable) and the engine can't share snapshots, the transactions
+// of the workers are begun too while writes are locked (see engine.lockWrites), so they read the same
+// snapshot. If writes can't be locked, a warning is printed and each worker reads its own snapshot.
+//
+// If configured with SnapshotPosition, the position of the snapshot is read right after it is taken,
+// while writes are still locked if they are, and kept in position.
+func (db *databaseConn) begin(ctx context.Context) error {
+	config := getConfigFromContext(ctx)
+	var unlock func() error
+	parallelism := config.GetParallelism()
+	if parallelism > 1 {
+		var err error
+		if unlock, err = db.engine.lockWrites(ctx, db.connection); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: locking writes to %s: %v. Each worker reads its own snapshot\n", db.name(), err)
+		}
+	}
+
+	// The transaction of the database goes first, followed by the ones of the workers if writes are locked
+	txs := make([]dbTx, 0, parallelism+1)
+	rollback := func() {
+		for _, tx := range txs {
+			tx.Rollback()
+		}
+		if unlock != nil {
+			unlock()
+		}
+	}
+	tx, err := db.beginSnapshot(ctx, db.writable, "")
+	if err != nil {
+		rollback()
+		return err
+	}
+	txs = append(txs, tx)
+
+	var position string
+	if config.SnapshotPosition {
+		if position, err = db.engine.snapshotPosition(ctx, tx); err != nil {
+			rollback()
+			return fmt.Errorf("snapshot position error: %v", err)
+		}
+	}
+
+	if unlock != nil {
+		for len(txs) <= parallelism {
+			tx, err := db.beginSnapshot(ctx, false, "")
+			if err != nil {
+				rollback()
+				return err
+			}
+			txs = append(txs, tx)
+		}
+		err := unlock()
+		unlock = nil
+		if err != nil {
+			rollback()
+			return fmt.Errorf("unlocking writes: %v", err)
+		}
+	}
+
+	db.tx, db.snapshots, db.position = txs[0], txs[1:], position
+	return nil
+}
+
+// beginSnapshot begins a transaction reading given snapshot (see engine.beginSnapshot), rendering dates
+// and times in the time zone of the config if there is one (see engine.setTimeZone).
+func (db *databaseConn) beginSnapshot(ctx context.Context, writable bool, snapshot string) (dbTx, error) {
+	tx, err := db.engine.beginSnapshot(ctx, db.connection, writable, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	if zone := getConfigFromContext(ctx).TimeZone; zone != "" {
+		if err := db.engine.setTimeZone(ctx, tx, zone); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("setting time zone %s: %v", zone, err)
+		}
+	}
+
+	return tx, nil
+}
+
+// configTable returns the name given table of this database has in the config (see mapped).
+func (db *databaseConn) configTable(ctx context.Context, table string) string {
+	if !db.mapped {
+		return table
+	}
+	return getConfigFromContext(ctx).GetTableName1(table)
+}
+
+// configColumn returns the name given column of given table of this database has in the config (see mapped).
+func (db *databaseConn) configColumn(ctx context.Context, table, column string) string {
+	if !db.mapped {
+		return column
+	}
+	return getConfigFromContext(ctx).GetColumnName1(db.configTable(ctx, table), column)
+}
+
+// worker returns a copy of the database holding its own transaction, so that its tables can be read
+// at the same time through another connection (see forEachTable). The copy must be released with release.
+//
+// The copy reads the same snapshot as the database if it was begun along with the database (see begin) or
+// the engine can share it (see engine.exportSnapshot), a snapshot taken when the copy is made otherwise.
+// It has its own cache of table definitions and no patch, as they can't be shared between goroutines.
+func (db *databaseConn) worker(ctx context.Context) (*databaseConn, error) {
+	w := &databaseConn{
+		connection: db.connection,
+		engine:     db.engine,
+		config:     db.config,
+		tables:     db.tables,
+		mapped:     db.mapped,
+	}
+	if n := len(db.snapshots); n > 0 {
+		w.tx, w.pooled = db.snapshots[n-1], true
+		db.snapshots = db.snapshots[:n-1]
+		return w, nil
+	}
+
+	snapshot, err := db.engine.exportSnapshot(ctx, db.tx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting snapshot: %v", err)
+	}
+	if w.tx, err = db.beginSnapshot(ctx, false, snapshot); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// release finishes the transaction of given worker (see worker), keeping the table definitions it fetched.
+// Transactions begun along with the database are kept instead, for the workers of the next tables.
+func (db *databaseConn) release(w *databaseConn) error {
+	for name, schema := range w.schemas {
+		if db.schemas == nil {
+			db.schemas = make(map[string]*tableSchema)
+		}
+		db.schemas[name] = schema
+	}
+	if w.pooled {
+		db.snapshots = append(db.snapshots, w.tx)
+		return nil
+	}
+	return w.tx.Rollback()
+}
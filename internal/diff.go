@@ -2,9 +2,11 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os/exec"
-	"strconv"
+	"os"
+	"sort"
+	"strings"
 )
 
 func runStrategyDiff(ctx context.Context) error {
@@ -17,18 +19,282 @@ func runStrategyDiff(ctx context.Context) error {
 		return err
 	}
 
-	// Execute Ndiff shell script
-	var detailArg string
-	if detailArg = ""; config.Detailed {
-		detailArg = "-d"
+	// Compare dirs
+	result, err := compareDirs(ctx, config.Dir, config.Dir2)
+	if err != nil {
+		return err
 	}
 
-	cmd, err := exec.Command("./Ndiff.sh", "-l", strconv.Itoa(config.Limit),
-		"-D", config.Dir, "-D", config.Dir2, detailArg).Output()
-	if err != nil {
-		fmt.Printf("error %s", err)
+	// Show every difference found
+	if err := result.write(os.Stdout, config.GetOutput(), config.Detailed); err != nil {
+		return err
+	}
+	if result.hasDifferences() {
+		return ErrDifferencesFound
 	}
-	fmt.Print(string(cmd))
 
 	return nil
 }
+
+// compareDirs compares the Ncsv files of both dirs and returns every difference found.
+// Files are paired by table name.
+func compareDirs(ctx context.Context, dir1, dir2 string) (*comparisonResult, error) {
+	// Get tables from both dirs
+	tables1, err := getNcsvTables(ctx, dir1)
+	if err != nil {
+		return nil, err
+	}
+	tables2, err := getNcsvTables(ctx, dir2)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newComparisonResult(dir1, dir2)
+
+	inDir2 := make(map[string]bool, len(tables2))
+	for _, t := range tables2 {
+		inDir2[t] = true
+	}
+	inDir1 := make(map[string]bool, len(tables1))
+	for _, t := range tables1 {
+		inDir1[t] = true
+		if !inDir2[t] {
+			result.TablesOnlyIn1 = append(result.TablesOnlyIn1, t)
+		}
+	}
+	for _, t := range tables2 {
+		if !inDir1[t] {
+			result.TablesOnlyIn2 = append(result.TablesOnlyIn2, t)
+		}
+	}
+
+	// Compare the tables existing in both dirs
+	for _, t := range tables1 {
+		if !inDir2[t] {
+			continue
+		}
+		if err := compareNcsvs(ctx, dir1, dir2, t, result); err != nil {
+			return nil, fmt.Errorf("table %s: %w", t, err)
+		}
+	}
+
+	return result, nil
+}
+
+// compareNcsvs compares the Ncsv files of given table, registering the differences in result.
+//
+// Columns are paired by name and the ones to be ignored are left out. Data types are read from the
+// schema files, so types to be ignored only apply to files that have one.
+//
+// If both files have a schema file with the same key, the files are already ordered by that key
+// and their rows are merged as they are read. If not (e.g. files created by an older version, or
+// a key column is ignored), the rows are read into memory and ordered before being merged.
+func compareNcsvs(ctx context.Context, dir1, dir2, table string, result *comparisonResult) error {
+	schema1, err := readNcsvSchema(dir1, table)
+	if err != nil {
+		return err
+	}
+	schema2, err := readNcsvSchema(dir2, table)
+	if err != nil {
+		return err
+	}
+
+	file1, err := os.Open(ncsvPath(dir1, table))
+	if err != nil {
+		return err
+	}
+	defer file1.Close()
+	file2, err := os.Open(ncsvPath(dir2, table))
+	if err != nil {
+		return err
+	}
+	defer file2.Close()
+
+	// Files without columns have no data to compare
+	reader1, err := newNcsvReader(file1)
+	if err != nil && !errors.Is(err, errNoColumns) {
+		return err
+	}
+	reader2, err := newNcsvReader(file2)
+	if err != nil && !errors.Is(err, errNoColumns) {
+		return err
+	}
+
+	// Get the columns of both files that are not to be ignored
+	columns1 := getNcsvColumns(ctx, table, reader1, schema1, schema2)
+	columns2 := getNcsvColumns(ctx, table, reader2, schema2, schema1)
+	if len(columns1) == 0 && len(columns2) == 0 {
+		return nil
+	}
+
+	// Rows can only be compared if both files have the same columns. Columns are paired by name,
+	// so the columns of database2 are reordered to match the ones of database1.
+	tableResult := result.table(table)
+	idx2 := columnIndexes(columnNames(columns2), columnNames(columns1))
+	if len(columns1) != len(columns2) || len(idx2) != len(columns1) {
+		tableResult.Schema = []string{fmt.Sprintf("table %s columns don't match", table)}
+		return nil
+	}
+	ordered2 := make([]tableColumn, 0, len(idx2))
+	for _, idx := range idx2 {
+		ordered2 = append(ordered2, columns2[idx])
+	}
+	if !equalColumns(columns1, ordered2) {
+		tableResult.Schema = []string{fmt.Sprintf("table %s column types don't match", table)}
+	}
+
+	// Get the key used to match the rows, it can only be used if none of its columns is ignored
+	var key []string
+	if schema1 != nil && len(columnIndexes(columnNames(columns1), schema1.Key)) == len(schema1.Key) {
+		key = schema1.Key
+	}
+	tableResult.Key = key
+	layout := newRowLayout(columns1, key)
+	if err := layout.configure(getConfigFromContext(ctx), table); err != nil {
+		return err
+	}
+
+	// Report the condition the rows of dir1 matched when they were dumped
+	if schema1 != nil {
+		tableResult.Filter = schema1.Filter
+	}
+
+	var src1, src2 rowSource
+	src1 = &projectedRowSource{src: reader1, idx: columnIndexes(reader1.columns, columnNames(columns1))}
+	src2 = &projectedRowSource{src: reader2, idx: columnIndexes(reader2.columns, columnNames(columns1))}
+	if key == nil || schema2 == nil || strings.Join(schema1.Key, ",") != strings.Join(schema2.Key, ",") {
+		if src1, err = sortedRowSource(src1, layout); err != nil {
+			return err
+		}
+		if src2, err = sortedRowSource(src2, layout); err != nil {
+			return err
+		}
+	}
+
+	return mergeRows(getConfigFromContext(ctx).GetLimit(), tableResult, layout, src1, src2, nil)
+}
+
+// getNcsvColumns returns the columns of the Ncsv file read by reader that are not to be ignored.
+//
+// Data types are read from schema, or from otherSchema (the schema of the other file being compared)
+// if schema doesn't exist. Returns nil if reader is nil, i.e. the file has no columns.
+func getNcsvColumns(ctx context.Context, table string, reader *ncsvReader, schema, otherSchema *ncsvSchema) []tableColumn {
+	if reader == nil {
+		return nil
+	}
+	if schema == nil {
+		schema = otherSchema
+	}
+
+	dataTypes := make(map[string]string)
+	if schema != nil {
+		for _, c := range schema.Columns {
+			dataTypes[c.Name] = c.DataType
+		}
+	}
+
+	conf := getConfigFromContext(ctx)
+	var columns []tableColumn
+	for _, name := range reader.columns {
+		if conf.IsColumnToBeIgnored(table, name) || conf.IsTypeToBeIgnored(dataTypes[name]) {
+			continue
+		}
+		columns = append(columns, tableColumn{Name: name, DataType: dataTypes[name]})
+	}
+	return columns
+}
+
+// getNcsvTables returns the names of the tables that have an Ncsv file inside dir and are not
+// to be ignored, sorted by name.
+func getNcsvTables(ctx context.Context, dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dir: %v", err)
+	}
+
+	var tables []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ncsvExtension) {
+			continue
+		}
+		table := strings.TrimSuffix(e.Name(), ncsvExtension)
+		if getConfigFromContext(ctx).IsTableToBeIgnored(table) {
+			continue
+		}
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	return tables, nil
+}
+
+// equalColumns returns true if both lists have the same columns. Data types are ignored
+// if any of the columns has no data type.
+func equalColumns(columns1, columns2 []tableColumn) bool {
+	if len(columns1) != len(columns2) {
+		return false
+	}
+	for i := range columns1 {
+		if columns1[i].Name != columns2[i].Name {
+			return false
+		}
+		if columns1[i].DataType != "" && columns2[i].DataType != "" && columns1[i].DataType != columns2[i].DataType {
+			return false
+		}
+	}
+	return true
+}
+
+// projectedRowSource returns the rows of src, keeping only the values at the given indexes.
+type projectedRowSource struct {
+	src rowSource
+	idx []int
+}
+
+func (s *projectedRowSource) next() ([]*string, error) {
+	row, err := s.src.next()
+	if row == nil || err != nil {
+		return nil, err
+	}
+
+	projected := make([]*string, len(s.idx))
+	for i, idx := range s.idx {
+		projected[i] = row[idx]
+	}
+	return projected, nil
+}
+
+// sliceRowSource returns the rows of a slice, one at a time.
+type sliceRowSource struct {
+	rows [][]*string
+}
+
+func (s *sliceRowSource) next() ([]*string, error) {
+	if len(s.rows) == 0 {
+		return nil, nil
+	}
+	row := s.rows[0]
+	s.rows = s.rows[1:]
+	return row, nil
+}
+
+// sortedRowSource reads every row of src and returns them ordered by the key of given layout.
+func sortedRowSource(src rowSource, layout *rowLayout) (rowSource, error) {
+	var rows [][]*string
+	for {
+		row, err := src.next()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return layout.compareKeys(rows[i], rows[j]) < 0
+	})
+
+	return &sliceRowSource{rows: rows}, nil
+}
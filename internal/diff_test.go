@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"go-db-compare/configs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestNcsv writes an Ncsv file for given table inside dir. If schema is not nil, its schema file is also written.
+func writeTestNcsv(t *testing.T, dir, table string, schema *ncsvSchema, columns []string, rows [][]*string) {
+	file, err := os.Create(ncsvPath(dir, table))
+	assert.NoError(t, err, "error creating file: %v", err)
+	defer file.Close()
+
+	w := newNcsvWriter(file)
+	assert.NoError(t, w.writeHeader(columns))
+	for _, row := range rows {
+		assert.NoError(t, w.writeRow(row))
+	}
+	assert.NoError(t, w.flush())
+
+	if schema != nil {
+		assert.NoError(t, writeNcsvSchema(dir, table, schema))
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// testKey returns the key of a row whose key is given column.
+func testKey(column, value string) []keyValue {
+	return []keyValue{{Column: column, Value: &value}}
+}
+
+func TestCompareDirs(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	schema := &ncsvSchema{
+		Columns: []tableColumn{{Name: "id", DataType: "int"}, {Name: "name", DataType: "varchar"}},
+		Key:     []string{"id"},
+	}
+	columns := []string{"id", "name"}
+
+	writeTestNcsv(t, dir1, "users", schema, columns, [][]*string{
+		{strPtr("1"), strPtr("a")},
+		{strPtr("2"), strPtr("b,c")},
+		{strPtr("10"), nil},
+	})
+	writeTestNcsv(t, dir2, "users", schema, columns, [][]*string{
+		{strPtr("2"), strPtr("b,d")},
+		{strPtr("9"), strPtr("x")},
+		{strPtr("10"), nil},
+	})
+
+	// Files without schema are matched by all of their columns
+	writeTestNcsv(t, dir1, "logs", nil, []string{"message"}, [][]*string{{strPtr("b")}, {strPtr("a")}})
+	writeTestNcsv(t, dir2, "logs", nil, []string{"message"}, [][]*string{{strPtr("a")}, {strPtr("b")}})
+
+	writeTestNcsv(t, dir1, "only1", schema, columns, nil)
+
+	result, err := compareDirs(ctx, dir1, dir2)
+	assert.NoError(t, err, "error comparing dirs: %v", err)
+
+	assert.EqualValues(t, []string{"only1"}, result.TablesOnlyIn1)
+	assert.Empty(t, result.TablesOnlyIn2)
+	assert.Len(t, result.Tables, 2)
+	assert.False(t, result.table("logs").hasDifferences())
+
+	users := result.table("users")
+	assert.EqualValues(t, 1, users.OnlyIn1)
+	assert.EqualValues(t, 1, users.OnlyIn2)
+	assert.EqualValues(t, 1, users.Changed)
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowOnlyIn1, Key: testKey("id", "1")},
+		{Type: rowChanged, Key: testKey("id", "2"), Values: []valueDifference{{Column: "name", Value1: strPtr("b,c"), Value2: strPtr("b,d")}}},
+		{Type: rowOnlyIn2, Key: testKey("id", "9")},
+	}, users.Rows)
+}
+
+func TestCompareDirsIgnoredColumns(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	dir1, dir2 := t.TempDir(), t.TempDir()
+
+	// database1 was dumped ignoring column1, database2 was dumped with every column
+	writeTestNcsv(t, dir1, "users", &ncsvSchema{
+		Columns: []tableColumn{{Name: "id", DataType: "int"}, {Name: "created", DataType: "timestamp"}},
+		Key:     []string{"id"},
+	}, []string{"id", "created"}, [][]*string{
+		{strPtr("1"), strPtr("2023-01-01 00:00:00")},
+	})
+	writeTestNcsv(t, dir2, "users", &ncsvSchema{
+		Columns: []tableColumn{{Name: "column1", DataType: "int"}, {Name: "id", DataType: "int"}, {Name: "created", DataType: "timestamp"}},
+		Key:     []string{"id"},
+	}, []string{"column1", "id", "created"}, [][]*string{
+		{strPtr("5"), strPtr("1"), strPtr("2023-06-01 00:00:00")},
+	})
+
+	// Ignored tables are not compared
+	writeTestNcsv(t, dir1, "tableName1", nil, []string{"id"}, [][]*string{{strPtr("1")}})
+
+	result, err := compareDirs(ctx, dir1, dir2)
+	assert.NoError(t, err, "error comparing dirs: %v", err)
+	assert.False(t, result.hasDifferences())
+}
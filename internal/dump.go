@@ -1,13 +1,10 @@
 package internal
 
 import (
-	"bufio"
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"os"
-	"strings"
 
 	"golang.org/x/sys/unix"
 )
@@ -53,8 +50,6 @@ func runStrategyDump2(ctx context.Context) error {
 }
 
 func createNcsvs(ctx context.Context, db *databaseConn, dir string) error {
-	var err error
-
 	// Check if dir is writable/exists
 	if err := isDirValid(dir); err != nil {
 		return err
@@ -63,9 +58,8 @@ func createNcsvs(ctx context.Context, db *databaseConn, dir string) error {
 		return err
 	}
 
-	// Begin transaction
-	db.tx, err = db.connection.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
+	// Begin transaction, so every table is read from the same snapshot
+	if err := db.begin(ctx); err != nil {
 		return err
 	}
 
@@ -74,27 +68,27 @@ func createNcsvs(ctx context.Context, db *databaseConn, dir string) error {
 		return err
 	}
 
-	for _, table := range db.tables {
-		if err := createTableNcsv(ctx, db, table.Name, dir); err != nil {
-			return err
-		}
-	}
-	return nil
+	return forEachTable(ctx, len(db.tables), []*databaseConn{db}, func(ctx context.Context, dbs []*databaseConn, i int) error {
+		return createTableNcsv(ctx, dbs[0], db.tables[i].Name, dir)
+	})
 }
 
+// createTableNcsv writes the data of given table into an Ncsv file inside dir. Only the rows matching
+// the condition configured for the table are written.
+//
+// The rows are streamed from the database ordered by key and written as they are read,
+// so memory usage doesn't depend on the size of the table.
 func createTableNcsv(ctx context.Context, db *databaseConn, tableName, dir string) error {
-	var w *bufio.Writer
-
-	file, err := os.Create(fmt.Sprintf("%s/%s.Ncsv", dir, tableName))
+	file, err := os.Create(ncsvPath(dir, tableName))
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	w = bufio.NewWriter(file)
+	w := newNcsvWriter(file)
 
-	// Write Ncsv content
-	data, columns, err := getDataFromTable(ctx, db, tableName)
+	// Get columns and key of the table
+	columns, err := getTableColumns(ctx, db, tableName)
 	if err != nil {
 		if errors.Is(err, errNoColumns) {
 			err = nil
@@ -102,44 +96,55 @@ func createTableNcsv(ctx context.Context, db *databaseConn, tableName, dir strin
 		}
 		return err
 	}
-
-	// Handle columns
-	if len(columns) == 0 {
-		return nil
+	key, err := getTableKey(ctx, db, tableName, columnNames(columns))
+	if err != nil {
+		return err
 	}
 
-	w.WriteString(strings.Join(columns, ","))
-	w.WriteString("\n")
+	// Write the schema, used to know how the rows are ordered when comparing Ncsv files
+	where := getConfigFromContext(ctx).GetTableFilter(tableName)
+	if err := writeNcsvSchema(dir, tableName, &ncsvSchema{Columns: columns, Key: key, Filter: where}); err != nil {
+		return err
+	}
 
-	// Handle data
-	if len(data) == 0 {
-		return nil
+	// Write Ncsv content
+	if err := w.writeHeader(columnNames(columns)); err != nil {
+		return err
 	}
 
-	var dumpRow []string
-	for _, row := range data {
-		dumpRow = append(dumpRow, row)
+	rows, err := queryTableData(ctx, db, tableName, columns, key, where)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-		w.WriteString(strings.Join(dumpRow, ","))
-		w.WriteString("\n")
+	src := &sqlRowSource{rows: rows, columns: len(columns)}
+	for {
+		row, err := src.next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
 
-		dumpRow = nil
+		if err := w.writeRow(row); err != nil {
+			return err
+		}
 	}
 
-	w.Flush()
-
-	return nil
+	return w.flush()
 }
 
 // isDirValid returns whether the given file or directory exists and has write permissions
 func isDirValid(path string) error {
 	file, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("error checking dir: %v", err)
+		return fmt.Errorf("%w: error checking dir: %v", ErrUsage, err)
 	}
 
 	if !file.IsDir() {
-		return fmt.Errorf("destination is not a directory")
+		return fmt.Errorf("%w: destination is not a directory", ErrUsage)
 	}
 
 	return nil
@@ -147,7 +152,7 @@ func isDirValid(path string) error {
 
 func hasWritePermissions(path string) error {
 	if err := unix.Access(path, unix.W_OK); err != nil {
-		return fmt.Errorf("dir has no write permissions")
+		return fmt.Errorf("%w: dir has no write permissions", ErrUsage)
 	}
 	return nil
 }
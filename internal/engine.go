@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go-db-compare/configs"
+)
+
+const (
+	// List of available database engines
+	engineMySQL    = "mysql"
+	enginePostgres = "postgres"
+	engineSQLite   = "sqlite"
+)
+
+// engine holds everything that depends on the database engine being compared.
+type engine interface {
+	// driverName returns the name of the database/sql driver used to connect to the database.
+	driverName() string
+	// dataSourceName returns the data source name used to connect to given database, writable if the
+	// connection is used to write to it (see databaseConn.writable).
+	dataSourceName(dbConfig *configs.Database, writable bool) string
+	// namespace returns the namespace holding the tables to compare (database in MySQL, schema in PostgreSQL, main in SQLite).
+	namespace(dbConfig *configs.Database) string
+
+	// quote returns given identifier quoted.
+	quote(identifier string) string
+	// placeholder returns the placeholder of the n-th argument of a query, starting at 1.
+	placeholder(n int) string
+	// quoteValue returns given value as a string literal.
+	quoteValue(value string) string
+
+	// beginSnapshot begins a repeatable read transaction reading a consistent snapshot of the database, read-only
+	// unless writable is true. If snapshot is not empty, the transaction reads the snapshot exported by exportSnapshot.
+	beginSnapshot(ctx context.Context, db *sql.DB, writable bool, snapshot string) (dbTx, error)
+	// exportSnapshot returns the id of the snapshot read by given transaction, so that other transactions can
+	// read the same snapshot (see beginSnapshot). Returns an empty id if the engine can't share snapshots.
+	exportSnapshot(ctx context.Context, tx dbTx) (string, error)
+	// lockWrites blocks writes to the database until unlock is called, so that the transactions begun meanwhile
+	// read the same snapshot. Returns a nil unlock if the engine doesn't need it to share snapshots.
+	lockWrites(ctx context.Context, db *sql.DB) (unlock func() error, err error)
+	// snapshotPosition returns the position in the log of the database (e.g. the binlog) of the snapshot read by
+	// given transaction. Returns an empty position if the database has no log.
+	snapshotPosition(ctx context.Context, tx dbTx) (string, error)
+	// setTimeZone sets the time zone dates and times are rendered in by given transaction (e.g. the values of
+	// MySQL TIMESTAMP or PostgreSQL timestamptz columns). Does nothing if the engine has no time zones.
+	setTimeZone(ctx context.Context, tx dbTx, zone string) error
+
+	// stmtGetAllTables returns the query listing the tables of the namespace, as (name, type) rows.
+	// The type must be either tableTypeBaseTable or tableTypeView.
+	stmtGetAllTables() string
+	// stmtGetTableColumns returns the query listing the columns of a table, as (name, data type) rows.
+	// The query is formatted with the table and the namespace.
+	stmtGetTableColumns() string
+	// stmtGetTableKeys returns the query listing the columns of the unique keys of a table, as (key name, column,
+	// nullable) rows, with the primary key first. The query is formatted with the table and the namespace.
+	stmtGetTableKeys() string
+	// getTableSchema returns the definition of given table, as compared by compareSchema.
+	getTableSchema(ctx context.Context, tx dbTx, namespace string, table fullTable) (*tableSchema, error)
+	// createTableStatements returns the statements creating given table (or view) as defined by schema.
+	createTableStatements(table string, schema *tableSchema) []string
+	// alterTableStatements returns the statements applying given changes to a table. Changes that
+	// can't be applied by a statement are returned as comments (starting with --).
+	alterTableStatements(changes *tableChanges) []string
+
+	// selectExpression returns the expression used to select the value of given column as text.
+	selectExpression(column tableColumn) string
+	// orderExpression returns the expression used to order the rows by given column. Numeric columns must
+	// be ordered as numbers and every other column must be ordered by bytes, with null values first, as
+	// compareValues compares them.
+	orderExpression(column tableColumn) string
+	// checksumExpression returns the aggregate expression computing the checksum of given columns over a set of rows.
+	// The checksum must not depend on the order of the rows.
+	checksumExpression(columns []tableColumn) string
+}
+
+// getEngine returns the engine for the given driver. If no driver is given, MySQL is used.
+func getEngine(driver string) (engine, error) {
+	switch driver {
+	case "", engineMySQL:
+		return mysqlEngine{}, nil
+	case enginePostgres:
+		return postgresEngine{}, nil
+	case engineSQLite:
+		return sqliteEngine{}, nil
+	default:
+		return nil, fmt.Errorf("%w: driver %s not valid", ErrUsage, driver)
+	}
+}
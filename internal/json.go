@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// jsonTypes holds the data types whose values are JSON documents.
+var jsonTypes = map[string]bool{
+	"json":  true,
+	"jsonb": true,
+}
+
+// jsonPathStep is a step of a JSON path: the member of an object with a name, the element of an array
+// at an index, or every member or element if wildcard is true.
+type jsonPathStep struct {
+	member   string
+	index    int // -1 if the step is a member
+	wildcard bool
+}
+
+// jsonPath is a path to values inside a JSON document, e.g. $.items[*].price.
+type jsonPath []jsonPathStep
+
+// parseJSONPath parses given path, written as in MySQL: $ followed by members (.name, ."name" or .*)
+// and array elements ([0] or [*]).
+func parseJSONPath(path string) (jsonPath, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSON path %s doesn't start with $", path)
+	}
+
+	var steps jsonPath
+	for rest := path[1:]; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, ".*"):
+			steps = append(steps, jsonPathStep{index: -1, wildcard: true})
+			rest = rest[2:]
+		case strings.HasPrefix(rest, `."`):
+			end := strings.Index(rest[2:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("JSON path %s has an unterminated member name", path)
+			}
+			steps = append(steps, jsonPathStep{member: rest[2 : 2+end], index: -1})
+			rest = rest[3+end:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("JSON path %s has an empty member name", path)
+			}
+			steps = append(steps, jsonPathStep{member: rest[1 : 1+end], index: -1})
+			rest = rest[1+end:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("JSON path %s has an unterminated array index", path)
+			}
+			if index := strings.TrimSpace(rest[1:end]); index == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else if n, err := strconv.Atoi(index); err == nil && n >= 0 {
+				steps = append(steps, jsonPathStep{index: n})
+			} else {
+				return nil, fmt.Errorf("JSON path %s has an invalid array index %s", path, index)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSON path %s is not valid at %s", path, rest)
+		}
+	}
+
+	return steps, nil
+}
+
+// equalJSON returns whether both values are the same JSON document, whatever the order of the members of
+// their objects and the whitespace between them. Numbers are compared by value (e.g. 1.0 is the same as 1).
+// The values at given paths are left out of both documents. Returns false if any of the values is not JSON.
+func equalJSON(value1, value2 string, ignored []jsonPath) bool {
+	doc1, err1 := decodeJSON(value1)
+	doc2, err2 := decodeJSON(value2)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	for _, path := range ignored {
+		doc1 = removeJSONPath(doc1, path)
+		doc2 = removeJSONPath(doc2, path)
+	}
+	return equalJSONValues(doc1, doc2)
+}
+
+// decodeJSON returns the document held by given value, keeping numbers as they are written.
+func decodeJSON(value string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after JSON document")
+	}
+	return doc, nil
+}
+
+// removeJSONPath removes from given document the values at given path, returning the document.
+// Members are removed from their objects, while elements are replaced with null so that the
+// position of the rest of elements of their arrays is kept. The whole document is removed
+// (replaced with null) if the path is $.
+func removeJSONPath(doc interface{}, path jsonPath) interface{} {
+	if len(path) == 0 {
+		return nil
+	}
+
+	step, last := path[0], len(path) == 1
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if step.index >= 0 {
+			return doc
+		}
+		for name, member := range v {
+			if !step.wildcard && name != step.member {
+				continue
+			}
+			if last {
+				delete(v, name)
+			} else {
+				v[name] = removeJSONPath(member, path[1:])
+			}
+		}
+	case []interface{}:
+		if step.index < 0 && !step.wildcard {
+			return doc
+		}
+		for i, element := range v {
+			if step.wildcard || i == step.index {
+				v[i] = removeJSONPath(element, path[1:])
+			}
+		}
+	}
+	return doc
+}
+
+// equalJSONValues returns whether both decoded JSON values are the same (see equalJSON).
+func equalJSONValues(value1, value2 interface{}) bool {
+	switch v1 := value1.(type) {
+	case map[string]interface{}:
+		v2, ok := value2.(map[string]interface{})
+		if !ok || len(v1) != len(v2) {
+			return false
+		}
+		for name, member1 := range v1 {
+			member2, ok := v2[name]
+			if !ok || !equalJSONValues(member1, member2) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		v2, ok := value2.([]interface{})
+		if !ok || len(v1) != len(v2) {
+			return false
+		}
+		for i := range v1 {
+			if !equalJSONValues(v1[i], v2[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		v2, ok := value2.(json.Number)
+		if !ok {
+			return false
+		}
+		n1, ok1 := new(big.Rat).SetString(v1.String())
+		n2, ok2 := new(big.Rat).SetString(v2.String())
+		if !ok1 || !ok2 {
+			return v1 == v2
+		}
+		return n1.Cmp(n2) == 0
+	default:
+		// Strings, booleans and null
+		return value1 == value2
+	}
+}
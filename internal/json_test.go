@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	path, err := parseJSONPath(`$.items[*]."unit price".tags[0].*`)
+	assert.NoError(t, err, "error parsing path: %v", err)
+	assert.EqualValues(t, jsonPath{
+		{member: "items", index: -1},
+		{wildcard: true},
+		{member: "unit price", index: -1},
+		{member: "tags", index: -1},
+		{index: 0},
+		{index: -1, wildcard: true},
+	}, path)
+
+	for _, invalid := range []string{"items", "$.", "$..a", "$.a[", "$.a[-1]", `$."a`, "$a"} {
+		_, err := parseJSONPath(invalid)
+		assert.Error(t, err, "path %s", invalid)
+	}
+}
+
+func TestEqualJSON(t *testing.T) {
+	tests := []struct {
+		value1   string
+		value2   string
+		ignored  []string
+		expected bool
+	}{
+		{`{"a": 1, "b": [1, 2]}`, `{"b":[1,2],"a":1}`, nil, true},
+		{`{"a": 1.0}`, `{"a": 1}`, nil, true},
+		{`{"a": 1}`, `{"a": "1"}`, nil, false},
+		{`[1, 2]`, `[2, 1]`, nil, false},
+		{`{"a": 1}`, `{"a": 1, "b": null}`, nil, false},
+		{`{"a": 1, "updated_at": "2023"}`, `{"a": 1, "updated_at": "2024"}`, []string{"$.updated_at"}, true},
+		{`{"a": 1, "updated_at": "2023"}`, `{"a": 1}`, []string{"$.updated_at"}, true},
+		{`{"a": 1, "updated_at": "2023"}`, `{"a": 2, "updated_at": "2024"}`, []string{"$.updated_at"}, false},
+		{`{"items": [{"id": 1, "at": 1}, {"id": 2, "at": 2}]}`, `{"items": [{"id": 1, "at": 3}, {"id": 2}]}`, []string{"$.items[*].at"}, true},
+		{`{"items": [1, 2, 3]}`, `{"items": [9, 2, 3]}`, []string{"$.items[0]"}, true},
+		{`{"a": 1}`, `not json`, nil, false},
+		{`{"a": 1} {}`, `{"a": 1}`, nil, false},
+	}
+
+	for _, test := range tests {
+		var ignored []jsonPath
+		for _, p := range test.ignored {
+			path, err := parseJSONPath(p)
+			assert.NoError(t, err, "error parsing path: %v", err)
+			ignored = append(ignored, path)
+		}
+		assert.EqualValues(t, test.expected, equalJSON(test.value1, test.value2, ignored), "%s %s", test.value1, test.value2)
+	}
+}
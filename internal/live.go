@@ -5,18 +5,13 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"regexp"
+	"os"
 	"sort"
 	"strings"
 )
 
 const (
-	stmtGetAllTables        = "SHOW FULL TABLES"
-	stmtGetTableInformation = "SHOW CREATE TABLE `%s` "
-	stmtGetTableData        = "SELECT %s FROM `%s`"
-	stmtGetTableColumns     = `SELECT COLUMN_NAME, DATA_TYPE 
-	FROM INFORMATION_SCHEMA.COLUMNS 
-	WHERE TABLE_NAME = '%s' AND TABLE_SCHEMA = '%s';`
+	stmtGetTableData = "SELECT %s FROM %s%s ORDER BY %s"
 
 	tableTypeBaseTable = "BASE TABLE"
 	tableTypeView      = "VIEW"
@@ -32,6 +27,16 @@ type fullTable struct {
 	Type string // "BASE TABLE", "VIEW"
 }
 
+// tableData holds what is queried from a table in one of the databases: its name, the columns
+// being compared and the key its rows are ordered by.
+type tableData struct {
+	name    string
+	columns []tableColumn
+	key     []string
+	// where holds the condition configured for the table (see configs.Conf.GetTableFilter), empty if its rows are not filtered.
+	where string
+}
+
 func runStrategyLive(ctx context.Context) error {
 	config := getConfigFromContext(ctx)
 	// Connect to databases
@@ -44,235 +49,454 @@ func runStrategyLive(ctx context.Context) error {
 		return err
 	}
 
+	// Schemas can only be migrated if they are compared, and rows can only be fixed with the values read
+	// from database1 if they are not normalized
+	schemaDiff := config.GetOutput() == outputSchemaDiff
+	dataDiff := config.GetOutput() == outputDataDiff
+	if (schemaDiff || dataDiff) && isDataOnly(ctx, database1, database2) {
+		return fmt.Errorf("%w: output %s needs both databases to be of the same engine and data_only to be false",
+			ErrUsage, config.GetOutput())
+	}
+
+	// Write the statements fixing the rows of database2 while comparing them
+	var patch *patchFile
+	if dataDiff {
+		patch, err = newPatchFile(config.GetDataDiffFile(), config.Database1.Label, config.Database2.Label)
+		if err != nil {
+			return fmt.Errorf("datadiff error: %v", err)
+		}
+		database2.patch = &dataPatch{engine: database2.engine, out: patch}
+	}
+
 	// Compare databases
-	err = compareDatabases(ctx, database1, database2)
+	result, err := compareDatabases(ctx, database1, database2)
+	if dataDiff {
+		if closeErr := patch.close(); err == nil && closeErr != nil {
+			return fmt.Errorf("datadiff error: %v", closeErr)
+		}
+	}
 	if err != nil {
 		return err
 	}
 
+	// Show every difference found
+	if err := result.write(os.Stdout, config.GetOutput(), config.Detailed); err != nil {
+		return err
+	}
+
+	// Write the statements migrating the schema of database2
+	if schemaDiff {
+		if err := writeSchemaMigration(ctx, database1, database2, config.GetSchemaDiffFile()); err != nil {
+			return fmt.Errorf("schemadiff error: %v", err)
+		}
+		fmt.Printf("schema migration written to %s\n", config.GetSchemaDiffFile())
+	}
+	if dataDiff {
+		fmt.Printf("data patch written to %s\n", config.GetDataDiffFile())
+	}
+	if result.hasDifferences() {
+		return ErrDifferencesFound
+	}
+
 	return nil
 }
 
-func compareDatabases(ctx context.Context, db1 *databaseConn, db2 *databaseConn) error {
-	var err error
+// compareDatabases compares the schema and data of both databases and returns every difference found.
+func compareDatabases(ctx context.Context, db1 *databaseConn, db2 *databaseConn) (*comparisonResult, error) {
+	config := getConfigFromContext(ctx)
 
-	// Begin transaction
-	db1.tx, err = db1.connection.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return err
+	// Tables and columns of database2 may be named differently
+	db2.mapped = true
+
+	// Begin transactions, so every table is read from the same snapshot
+	if err := db1.begin(ctx); err != nil {
+		return nil, err
 	}
-	db2.tx, err = db2.connection.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return err
+	if err := db2.begin(ctx); err != nil {
+		return nil, err
 	}
+	result := newComparisonResult(config.Database1.Label, config.Database2.Label)
+
+	// Record where the snapshots are in the log of each database
+	result.Position1, result.Position2 = db1.position, db2.position
 
 	// Get tables from both databases
 	if err := db1.getTables(ctx); err != nil {
-		return err
+		return nil, err
 	}
 	if err := db2.getTables(ctx); err != nil {
-		return err
-	}
-
-	// Compare number of tables
-	if len(db1.tables) != len(db2.tables) {
-		return fmt.Errorf("number of tables doesn't match. %s -> %d, %s -> %d",
-			db1.config.DBName, len(db1.tables), db2.config.DBName, len(db2.tables))
+		return nil, err
 	}
 
 	// Compare schemas
-	if err := compareSchema(ctx, db1, db2); err != nil {
-		return fmt.Errorf("schema error: %v", err)
+	if err := compareSchema(ctx, db1, db2, result); err != nil {
+		return nil, fmt.Errorf("schema error: %w", err)
 	}
 
 	// Compare data
-	if err := compareData(ctx, db1, db2); err != nil {
-		return fmt.Errorf("data error: %v", err)
+	if err := compareData(ctx, db1, db2, result); err != nil {
+		return nil, fmt.Errorf("data error: %w", err)
 	}
 
-	return nil
+	// Tables may have been compared in any order, report them in the order of database1
+	result.sortTables(tableNames(db1.tables))
+
+	return result, nil
 }
 
-func compareSchema(ctx context.Context, db1 *databaseConn, db2 *databaseConn) error {
+// compareSchema compares the schema of every table present in both databases, registering the differences in result.
+// Tables only present in one of the databases are registered as such (see pairTables).
+// In data only mode (see isDataOnly), only the names of the tables are compared.
+func compareSchema(ctx context.Context, db1 *databaseConn, db2 *databaseConn, result *comparisonResult) error {
+	dataOnly := isDataOnly(ctx, db1, db2)
+
+	// Compare tables names
+	pairs, only1, only2 := pairTables(ctx, db1, db2)
+	for _, t := range only1 {
+		result.TablesOnlyIn1 = append(result.TablesOnlyIn1, t.Name)
+	}
+	for _, t := range only2 {
+		result.TablesOnlyIn2 = append(result.TablesOnlyIn2, t.Name)
+	}
+	for _, p := range pairs {
+		if p.table1.Type != p.table2.Type {
+			result.Problems = append(result.Problems, fmt.Sprintf("table types don't match. %s -> %s %s, %s -> %s %s",
+				db1.name(), p.table1.Name, p.table1.Type, db2.name(), p.table2.Name, p.table2.Type))
+		}
+	}
+	if dataOnly {
+		return nil
+	}
+
 	// Go through every table and check their schema
-	for i := 0; i < len(db1.tables); i++ {
-		// Compare tables names
-		if db1.tables[i] != db2.tables[i] {
-			return fmt.Errorf("table names don't match")
+	return forEachTable(ctx, len(pairs), []*databaseConn{db1, db2}, func(ctx context.Context, dbs []*databaseConn, i int) error {
+		p := pairs[i]
+		if p.table1.Type != p.table2.Type {
+			return nil
 		}
-		table := db1.tables[i]
 
-		// Get table info
-		var tableSQL1, tableSQL2, doesntMatter sql.NullString
-		query := fmt.Sprintf(stmtGetTableInformation, table.Name)
-		queryStmtDB1, err := db1.tx.PrepareContext(ctx, query)
+		// Get table definitions, naming the columns of database2 as in database1
+		schema1, err := dbs[0].getTableSchema(ctx, p.table1)
 		if err != nil {
 			return err
 		}
-		queryStmtDB2, err := db2.tx.PrepareContext(ctx, query)
+		schema2, err := dbs[1].getTableSchema(ctx, p.table2)
 		if err != nil {
 			return err
 		}
+		config := getConfigFromContext(ctx)
+		schema2 = schema2.renameColumns(func(column string) string {
+			return config.GetColumnName1(p.table1.Name, column)
+		})
 
-		// We expect to have two fields from the select if the table type is tableTypeBaseTable.
-		// If this table type is actually tableTypeView, we expect to have four fields from the select.
-		//
-		// (note that we can not do the queries before the if statement because if two queries occur
-		// without a scan in between, a busy error occurs)
-		if table.Type == tableTypeView {
-			rowDB1 := queryStmtDB1.QueryRowContext(ctx)
-			if err := rowDB1.Scan(&doesntMatter, &tableSQL1, &doesntMatter, &doesntMatter); err != nil {
-				return err
-			}
-			rowDB2 := queryStmtDB2.QueryRowContext(ctx)
-			if err := rowDB2.Scan(&doesntMatter, &tableSQL2, &doesntMatter, &doesntMatter); err != nil {
-				return err
-			}
-		} else {
-			rowDB1 := queryStmtDB1.QueryRowContext(ctx)
-			if err := rowDB1.Scan(&doesntMatter, &tableSQL1); err != nil {
-				return err
-			}
-			rowDB2 := queryStmtDB2.QueryRowContext(ctx)
-			if err := rowDB2.Scan(&doesntMatter, &tableSQL2); err != nil {
-				return err
-			}
+		// Compare table schema
+		if diffs := diffTableSchemas(schema1, schema2, result.Label1, result.Label2); len(diffs) > 0 {
+			result.table(p.table1.Name).Schema = diffs
 		}
+		return nil
+	})
+}
 
-		// Remove irrelevant elements to the schema comparison
-		if err := removeSchemaIrrelevantElements(&tableSQL1); err != nil {
-			return err
+// compareData compares the data of every table present in both databases, registering the differences in result.
+//
+// Rows are matched using the table key (see getTableKey), so rows that only exist in one of the
+// databases don't affect the comparison of the remaining rows.
+//
+// When tables are compared at once (see forEachTable), the statements fixing the rows of each table
+// are kept in memory and written to the patch of database2 in table order once every table is compared.
+func compareData(ctx context.Context, db1 *databaseConn, db2 *databaseConn, result *comparisonResult) error {
+	// Go through every table and check their data
+	pairs, _, _ := pairTables(ctx, db1, db2)
+	patches := make([]*patchBuffer, len(pairs))
+	err := forEachTable(ctx, len(pairs), []*databaseConn{db1, db2}, func(ctx context.Context, dbs []*databaseConn, i int) error {
+		// Tables of different types were already reported when comparing schemas
+		p := pairs[i]
+		if p.table1.Type != p.table2.Type {
+			return nil
 		}
-		if err := removeSchemaIrrelevantElements(&tableSQL2); err != nil {
-			return err
+
+		if db2.patch != nil && dbs[1] != db2 {
+			patches[i] = &patchBuffer{}
+			dbs[1].patch = &dataPatch{engine: db2.engine, out: patches[i]}
 		}
+		return compareTableData(ctx, dbs[0], dbs[1], p.table1.Name, p.table2.Name, result)
+	})
+	if err != nil {
+		return err
+	}
 
-		// Compare table schema
-		if tableSQL1.String != tableSQL2.String {
-			return fmt.Errorf("table %s schemas don't match", table.Name)
+	for _, p := range patches {
+		if p == nil {
+			continue
+		}
+		if err := p.writeTo(db2.patch.out); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func compareData(ctx context.Context, db1 *databaseConn, db2 *databaseConn) error {
+// tablePair holds a table of database1 and the table of database2 it is compared with.
+type tablePair struct {
+	table1 fullTable
+	table2 fullTable
+}
+
+// pairTables pairs the tables of both databases by name, the tables of database2 being named as mapped
+// in the config (see configs.Conf.GetTableName2), so a table missing in one of the databases doesn't
+// affect how the rest are paired. Returns the pairs in the order of database1, and the tables only present
+// in database1 and in database2.
+//
+// In data only mode (see isDataOnly), names are compared case-insensitively, a table of database2 with
+// the same name taking precedence over one whose name only differs in case.
+func pairTables(ctx context.Context, db1 *databaseConn, db2 *databaseConn) ([]tablePair, []fullTable, []fullTable) {
 	config := getConfigFromContext(ctx)
-	// Go through every table and check their data
-	for _, table := range db1.tables {
-		// Get data from this table for database1
-		results1, columnsName, err := getDataFromTable(ctx, db1, table.Name)
-		if err != nil {
-			if errors.Is(err, errNoColumns) {
-				err = nil
-				continue
-			}
-			return err
+	dataOnly := isDataOnly(ctx, db1, db2)
+
+	tables2 := make(map[string]fullTable, len(db2.tables))
+	foldedTables2 := make(map[string]fullTable, len(db2.tables))
+	for _, t := range db2.tables {
+		tables2[t.Name] = t
+		if _, ok := foldedTables2[strings.ToLower(t.Name)]; !ok {
+			foldedTables2[strings.ToLower(t.Name)] = t
 		}
+	}
 
-		// Get data from this table for database2
-		results2, _, err := getDataFromTable(ctx, db2, table.Name)
-		if err != nil {
-			return err
+	var pairs []tablePair
+	var only1, only2 []fullTable
+	paired2 := make(map[string]bool, len(db2.tables))
+	for _, t1 := range db1.tables {
+		name2 := config.GetTableName2(t1.Name)
+		t2, ok := tables2[name2]
+		if !ok && dataOnly {
+			t2, ok = foldedTables2[strings.ToLower(name2)]
 		}
-
-		// Check if number of rows are the same
-		if len(results1) != len(results2) {
-			return fmt.Errorf("number of rows in table %s doesn't match. %s -> %d, %s -> %d",
-				table.Name, db1.config.DBName, len(results1), db2.config.DBName, len(results2))
+		if !ok || paired2[t2.Name] {
+			only1 = append(only1, t1)
+			continue
 		}
-
-		// Check if columns values are the same
-		for i := 0; i < len(results1); i++ {
-			// Check if columns are the same
-			if results1[i] == results2[i] {
-				continue
-			}
-
-			// Columns are not the same, check and print where the difference is
-			columns1 := strings.Split(results1[i], ",")
-			columns2 := strings.Split(results2[i], ",")
-
-			for j := 0; j < len(columns1); j++ {
-				if columns1[j] != columns2[j] {
-					s := `the value from table %s in column %s on row %d is not the same
-					` + config.Database1.Label + `:	'` + columns1[j] + `'
-					` + config.Database2.Label + `:	'` + columns2[j] + `'`
-					return fmt.Errorf(s, table.Name, columnsName[j], i+1)
-				}
-			}
+		pairs = append(pairs, tablePair{table1: t1, table2: t2})
+		paired2[t2.Name] = true
+	}
+	for _, t2 := range db2.tables {
+		if !paired2[t2.Name] {
+			only2 = append(only2, t2)
 		}
 	}
 
-	return nil
+	return pairs, only1, only2
 }
 
-// getDataFromTable returns the existing data from given table and its columns.
+// compareTableData compares the data of given table, named table1 in database1 and table2 in database2,
+// registering the differences in result.
 //
-// The data will be an array of strings, each string represents a row with every column seperated by ",".
-// If a value is null, then the string will contain "nil" instead.
-// example:
-// [1,"s",,nil], [id,string,emprtyString,nilValue]
-func getDataFromTable(ctx context.Context, db *databaseConn, table string) ([]string, []string, error) {
-	// Get query with right columns to fetch table data
-	query, err := makeQueryGetTableData(ctx, db, table)
+// The rows of both databases are streamed ordered by key and merged, so memory usage doesn't
+// depend on the size of the table.
+func compareTableData(ctx context.Context, db1 *databaseConn, db2 *databaseConn, table1, table2 string, result *comparisonResult) error {
+	dataOnly := isDataOnly(ctx, db1, db2)
+
+	// Get columns of this table for both databases
+	columns1, err := getTableColumns(ctx, db1, table1)
 	if err != nil {
-		return nil, nil, err
+		if errors.Is(err, errNoColumns) {
+			err = nil
+			return nil
+		}
+		return err
+	}
+	columns2, err := getTableColumns(ctx, db2, table2)
+	if err != nil && !errors.Is(err, errNoColumns) {
+		return err
+	}
+
+	// Rows can only be compared if both tables have the same columns
+	tableResult := result.table(table1)
+	config := getConfigFromContext(ctx)
+	columns2, ok := pairColumns(columns1, columns2, func(column string) string {
+		return config.GetColumnName2(table1, column)
+	}, dataOnly)
+	if !ok {
+		if len(tableResult.Schema) == 0 {
+			tableResult.Schema = []string{fmt.Sprintf("table %s columns don't match", table1)}
+		}
+		return nil
 	}
 
-	// Perform query
-	queryStmt, err := db.tx.PrepareContext(ctx, query)
+	// Get the columns used to match the rows, named as in each database
+	key1, err := getTableKey(ctx, db1, table1, columnNames(columns1))
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
-	rows, err := queryStmt.QueryContext(ctx)
+	tableResult.Key = key1
+	where := config.GetTableFilter(table1)
+	tableResult.Filter = where
+
+	var key2 []string
+	for _, idx := range columnIndexes(columnNames(columns1), key1) {
+		key2 = append(key2, columns2[idx].Name)
+	}
+
+	t1 := tableData{name: table1, columns: columns1, key: key1, where: where}
+	t2 := tableData{name: table2, columns: columns2, key: key2, where: config.GetTableFilter2(table1)}
+
+	// Compare the table by chunks if checksums are enabled. Tables without key can't be split into chunks,
+	// and chunks are only compared when both databases compute the checksums and name the columns the same way.
+	if getConfigFromContext(ctx).Checksum && len(key1) > 0 && db1.engine.driverName() == db2.engine.driverName() &&
+		table1 == table2 && strings.Join(columnNames(columns1), ",") == strings.Join(columnNames(columns2), ",") {
+		return compareTableChecksums(ctx, db1, db2, t1, t2, tableResult)
+	}
+
+	return compareTableRows(ctx, db1, db2, t1, t2, tableResult, "")
+}
+
+// compareTableRows compares the rows of given tables, registering the differences in tableResult.
+// If filter is not empty, only the rows matching it (and the condition configured for the table) are
+// compared, args holding the filter arguments.
+//
+// In data only mode (see isDataOnly), values are normalized before being compared (see normalizeValue).
+// If database2 has a patch, the statements fixing its rows are written to it.
+func compareTableRows(ctx context.Context, db1 *databaseConn, db2 *databaseConn, t1, t2 tableData,
+	tableResult *tableDifferences, filter string, args ...interface{}) error {
+	// Get data from this table for both databases
+	rows1, err := queryTableData(ctx, db1, t1.name, t1.columns, t1.key, combineFilters(t1.where, filter), args...)
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
-	defer rows.Close()
+	defer rows1.Close()
 
-	// Get columns returned
-	columns, err := rows.Columns()
+	rows2, err := queryTableData(ctx, db2, t2.name, t2.columns, t2.key, combineFilters(t2.where, filter), args...)
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	defer rows2.Close()
+
+	var src1, src2 rowSource
+	src1 = &sqlRowSource{rows: rows1, columns: len(t1.columns)}
+	src2 = &sqlRowSource{rows: rows2, columns: len(t2.columns)}
+	if isDataOnly(ctx, db1, db2) {
+		location := timeZoneLocation(getConfigFromContext(ctx).TimeZone)
+		src1 = &normalizedRowSource{src: src1, columns: t1.columns, location: location}
+		src2 = &normalizedRowSource{src: src2, columns: t2.columns, location: location}
 	}
 
-	// Scan query results
-	results := []string{}
-	for rows.Next() {
-		strs := make([]*string, len(columns))
-		vals := make([]interface{}, len(columns))
-		for i := range vals {
-			vals[i] = &strs[i]
+	var sink rowSink
+	if db2.patch != nil {
+		sink = db2.patch.table(t2)
+	}
+
+	config := getConfigFromContext(ctx)
+	layout := newRowLayout(t1.columns, t1.key)
+	if err := layout.configure(config, t1.name); err != nil {
+		return err
+	}
+	return mergeRows(config.GetLimit(), tableResult, layout, src1, src2, sink)
+}
+
+// isDataOnly returns whether only the data of both databases is compared, skipping their schemas.
+// This is the case when configured with data_only or when the databases are of different engines,
+// as their schemas can't be compared.
+//
+// In data only mode, tables and columns are paired case-insensitively and values are normalized
+// before being compared, so that databases of different engines can be compared.
+func isDataOnly(ctx context.Context, db1 *databaseConn, db2 *databaseConn) bool {
+	return getConfigFromContext(ctx).DataOnly || db1.engine.driverName() != db2.engine.driverName()
+}
+
+// pairColumns returns the columns of columns2 in the order of the columns of columns1 they are paired with,
+// or false if both tables don't have the same columns. Each column of columns1 is paired with the column of
+// columns2 named name2(column), or the same name if name2 is nil. If caseInsensitive is true, names are
+// compared case-insensitively.
+func pairColumns(columns1, columns2 []tableColumn, name2 func(column string) string, caseInsensitive bool) ([]tableColumn, bool) {
+	if len(columns1) != len(columns2) {
+		return nil, false
+	}
+
+	paired := make([]tableColumn, 0, len(columns1))
+	for _, c1 := range columns1 {
+		name := c1.Name
+		if name2 != nil {
+			name = name2(c1.Name)
 		}
-		if err := rows.Scan(vals...); err != nil {
-			return nil, nil, err
+
+		found := false
+		for _, c2 := range columns2 {
+			if name == c2.Name || (caseInsensitive && strings.EqualFold(name, c2.Name)) {
+				paired = append(paired, c2)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
 		}
-		results = append(results, strings.Join(removePointersFromStrings(strs), ","))
 	}
 
-	sort.Strings(results)
+	return paired, true
+}
 
-	return results, columns, nil
+// queryTableData returns the rows of given table with given columns, ordered by key.
+// If filter is not empty, only the rows matching it are returned, args holding the filter arguments.
+// The returned rows must be closed by the caller.
+func queryTableData(ctx context.Context, db *databaseConn, table string, columns []tableColumn, key []string,
+	filter string, args ...interface{}) (*sql.Rows, error) {
+	return db.tx.QueryContext(ctx, makeQueryGetTableData(db.engine, table, columns, key, filter), args...)
 }
 
-func removePointersFromStrings(pointers []*string) []string {
-	res := []string{}
-	for _, p := range pointers {
-		if p == nil {
-			res = append(res, "nil")
-		} else {
-			res = append(res, *p)
+// getTableKey returns the columns used to match the rows of given table.
+//
+// The key configured for the table is used if there is one. If not, the primary key is used,
+// or the first unique key if the table has no primary key. Only keys whose columns are all
+// present in given columns and not nullable are considered, as null values are not unique.
+// If no key is found, nil is returned and rows are matched using all of their columns.
+func getTableKey(ctx context.Context, db *databaseConn, table string, columns []string) ([]string, error) {
+	if key := getConfigFromContext(ctx).GetTableKey(table); key != nil {
+		if len(columnIndexes(columns, key)) != len(key) {
+			return nil, fmt.Errorf("%w: key configured for table %s has columns that are not being compared", ErrUsage, table)
+		}
+		return key, nil
+	}
+
+	rows, err := db.tx.QueryContext(ctx, fmt.Sprintf(db.engine.stmtGetTableKeys(), table, db.namespace()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Group the columns by index, keeping the order in which the indexes are returned
+	var indexes []string
+	indexColumns := make(map[string][]string)
+	nullable := make(map[string]bool)
+	for rows.Next() {
+		var index, column string
+		var columnNullable bool
+		if err := rows.Scan(&index, &column, &columnNullable); err != nil {
+			return nil, err
+		}
+		if _, ok := indexColumns[index]; !ok {
+			indexes = append(indexes, index)
 		}
+		indexColumns[index] = append(indexColumns[index], column)
+		nullable[index] = nullable[index] || columnNullable
 	}
-	return res
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, index := range indexes {
+		if !nullable[index] && len(columnIndexes(columns, indexColumns[index])) == len(indexColumns[index]) {
+			return indexColumns[index], nil
+		}
+	}
+
+	return nil, nil
 }
 
 // getTables inserts into the struct the existing tables in given database that are not to be ignored.
 func (db *databaseConn) getTables(ctx context.Context) error {
 	db.tables = make([]fullTable, 0)
 
-	rows, err := db.tx.QueryContext(ctx, stmtGetAllTables)
+	rows, err := db.tx.QueryContext(ctx, db.engine.stmtGetAllTables())
 	if err != nil {
 		return err
 	}
@@ -284,74 +508,134 @@ func (db *databaseConn) getTables(ctx context.Context) error {
 			return err
 		}
 
-		if tName.Valid && tType.Valid && !getConfigFromContext(ctx).IsTableToBeIgnored(tName.String) {
+		if tName.Valid && tType.Valid && !getConfigFromContext(ctx).IsTableToBeIgnored(db.configTable(ctx, tName.String)) {
 			db.tables = append(db.tables, fullTable{
 				Name: tName.String,
 				Type: tType.String,
 			})
 		}
 	}
-	return rows.Err()
-}
-
-// removeSchemaIrrelevantElements removes the irrelevant elements from the given string.
-// elements being removed:
-// - auto increment
-func removeSchemaIrrelevantElements(tableSchema *sql.NullString) error {
-	// If not valid, do nothing
-	if !tableSchema.Valid {
-		return nil
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	// Remove auto increment
-	re := regexp.MustCompile("AUTO_INCREMENT=.* ")
-	tableSchema.String = re.ReplaceAllString(tableSchema.String, "")
-
+	// Sort tables case-insensitively, so tables are reported in the same order whatever the engine
+	sort.SliceStable(db.tables, func(i, j int) bool {
+		return strings.ToLower(db.tables[i].Name) < strings.ToLower(db.tables[j].Name)
+	})
 	return nil
 }
 
-// makeQueryGetTableData returns the query to fetch the data from given table.
-// The query will contain only the columns that are not to be ignored.
-func makeQueryGetTableData(ctx context.Context, db *databaseConn, table string) (string, error) {
+// getTableColumns returns the columns of given table that are not to be ignored.
+func getTableColumns(ctx context.Context, db *databaseConn, table string) ([]tableColumn, error) {
 	// Get columns of table
-	rows, err := db.tx.QueryContext(ctx, fmt.Sprintf(stmtGetTableColumns, table, db.config.DBName))
+	rows, err := db.tx.QueryContext(ctx, fmt.Sprintf(db.engine.stmtGetTableColumns(), table, db.namespace()))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer rows.Close()
 
 	// Scan query results
-	columns := []string{}
+	columns := []tableColumn{}
 	for rows.Next() {
 		var column, dataType string
 		if err := rows.Scan(&column, &dataType); err != nil {
-			return "", err
+			return nil, err
 		}
 
 		// Append columns if they are not to be ignored
 		conf := getConfigFromContext(ctx)
-		if !conf.IsColumnToBeIgnored(table, column) && !conf.IsTypeToBeIgnored(dataType) {
-			columns = append(columns, column)
+		if !conf.IsColumnToBeIgnored(db.configTable(ctx, table), db.configColumn(ctx, table, column)) && !conf.IsTypeToBeIgnored(dataType) {
+			columns = append(columns, tableColumn{
+				Name:     column,
+				DataType: dataType,
+			})
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	if len(columns) == 0 {
-		return "", errNoColumns
+		return nil, errNoColumns
 	}
 
+	return columns, nil
+}
+
+// makeQueryGetTableData returns the query to fetch the data from given table.
+// The query will contain only the given columns and its rows will be ordered by key.
+// If filter is not empty, only the rows matching it are fetched.
+//
+// Numeric columns are ordered as numbers and every other column is ordered by bytes,
+// which is how compareValues compares them. If key is empty, rows are ordered by all columns.
+func makeQueryGetTableData(e engine, table string, columns []tableColumn, key []string, filter string) string {
 	// Build the string with the columns
 	var columnsBuilder strings.Builder
-	columnsBuilder.WriteString(fmt.Sprintf("`%s`", columns[0]))
+	for i, column := range columns {
+		if i > 0 {
+			columnsBuilder.WriteString(", ")
+		}
+		columnsBuilder.WriteString(e.selectExpression(column))
+	}
+
+	// Build the string with the order
+	orderColumns := key
+	if len(orderColumns) == 0 {
+		orderColumns = columnNames(columns)
+	}
 
-	if len(columns) > 1 {
-		// Make columns string to use in the query
-		for i := 1; i < len(columns); i++ {
-			columnsBuilder.WriteString(fmt.Sprintf(", `%s`", columns[i]))
+	var orderBuilder strings.Builder
+	for i, name := range orderColumns {
+		if i > 0 {
+			orderBuilder.WriteString(", ")
 		}
+		orderBuilder.WriteString(e.orderExpression(findColumn(columns, name)))
+	}
+
+	// Build the filter
+	if filter != "" {
+		filter = " WHERE " + filter
 	}
 
 	// Make final query
-	query := fmt.Sprintf(stmtGetTableData, columnsBuilder.String(), table)
+	return fmt.Sprintf(stmtGetTableData, columnsBuilder.String(), e.quote(table), filter, orderBuilder.String())
+}
+
+// tableNames returns the names of given tables.
+func tableNames(tables []fullTable) []string {
+	names := make([]string, 0, len(tables))
+	for _, t := range tables {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// combineFilters returns the condition matching the rows that match every given filter. Empty filters are left out.
+func combineFilters(filters ...string) string {
+	var conditions []string
+	for _, f := range filters {
+		if f != "" {
+			conditions = append(conditions, f)
+		}
+	}
 
-	return query, nil
+	switch len(conditions) {
+	case 0:
+		return ""
+	case 1:
+		return conditions[0]
+	default:
+		return "(" + strings.Join(conditions, ") AND (") + ")"
+	}
+}
+
+// findColumn returns the column with given name. If there is none, a column without data type is returned.
+func findColumn(columns []tableColumn, name string) tableColumn {
+	for _, c := range columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return tableColumn{Name: name}
 }
@@ -5,61 +5,13 @@ import (
 	"database/sql"
 	"fmt"
 	"go-db-compare/configs"
+	"regexp"
 	"testing"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
-	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestRemoveSchemaIrrelevantElementsOK(t *testing.T) {
-	tableSchema := &sql.NullString{
-		String: "AUTO_INCREMENT=123 cd",
-		Valid:  true,
-	}
-	err := removeSchemaIrrelevantElements(tableSchema)
-	assert.NoError(t, err, "expected no error, got %v", err)
-	assert.EqualValues(t, "cd", tableSchema.String)
-}
-
-func TestRemoveSchemaIrrelevantElements(t *testing.T) {
-	tableSchema := &sql.NullString{
-		Valid: false,
-	}
-	err := removeSchemaIrrelevantElements(tableSchema)
-	assert.NoError(t, err, "expected no error, got %v", err)
-}
-
-func TestRemoveSchemaIrrelevantElementsanything(t *testing.T) {
-	tableSchema := &sql.NullString{
-		String: "=.*",
-		Valid:  true,
-	}
-	err := removeSchemaIrrelevantElements(tableSchema)
-	assert.NoError(t, err, "expected no error, got %v", err)
-	assert.EqualValues(t, "=.*", tableSchema.String)
-}
-
-func TestRemoveSchemaIrrelevantElementsemptystring(t *testing.T) {
-	tableSchema := &sql.NullString{
-		String: "",
-		Valid:  true,
-	}
-	err := removeSchemaIrrelevantElements(tableSchema)
-	assert.NoError(t, err, "expected no error, got %v", err)
-	assert.EqualValues(t, "", tableSchema.String)
-}
-
-func TestRemoveSchemaIrrelevantElements_cd(t *testing.T) {
-	tableSchema := &sql.NullString{
-		String: "Auto_increment=123 cd",
-		Valid:  true,
-	}
-	err := removeSchemaIrrelevantElements(tableSchema)
-	assert.NoError(t, err, "expected no error, got %v", err)
-	assert.EqualValues(t, "Auto_increment=123 cd", tableSchema.String)
-}
-
 func getMockData(ctx context.Context) (*databaseConn, sqlmock.Sqlmock, error) {
 	var db *sql.DB
 	db, mock, err := sqlmock.New()
@@ -68,7 +20,8 @@ func getMockData(ctx context.Context) (*databaseConn, sqlmock.Sqlmock, error) {
 	}
 	conn := &databaseConn{
 		connection: db,
-		config:     &mysql.Config{DBName: ""},
+		config:     &configs.Database{},
+		engine:     mysqlEngine{},
 	}
 	return conn, mock, err
 }
@@ -84,21 +37,25 @@ func TestMakeQueryGetTableDataOK(t *testing.T) {
 	conn.tx, err = conn.connection.BeginTx(ctx, &sql.TxOptions{})
 	assert.NoError(t, err, "error creating database transaction: %v", err)
 
-	mock.ExpectQuery(fmt.Sprintf(stmtGetTableColumns, "tableName", conn.config.DBName)).
+	mock.ExpectQuery(fmt.Sprintf(stmtGetTableColumns, "tableName", conn.config.Database)).
 		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE"}).
 			AddRow("id", "int").
 			AddRow("email", "string").
 			AddRow("name", "string"))
 
-	query, err := makeQueryGetTableData(ctx, conn, "tableName")
-	assert.NoError(t, err, "error making query for getting data: %v", err)
+	columns, err := getTableColumns(ctx, conn, "tableName")
+	assert.NoError(t, err, "error getting columns: %v", err)
 
-	expectedQuery := "SELECT `id`, `email`, `name` FROM `tableName`"
+	query := makeQueryGetTableData(mysqlEngine{}, "tableName", columns, []string{"id"}, "")
+	expectedQuery := "SELECT `id`, `email`, `name` FROM `tableName` ORDER BY `id`"
+	assert.EqualValues(t, expectedQuery, query)
 
+	query = makeQueryGetTableData(mysqlEngine{}, "tableName", columns, nil, "")
+	expectedQuery = "SELECT `id`, `email`, `name` FROM `tableName` ORDER BY `id`, CAST(`email` AS BINARY), CAST(`name` AS BINARY)"
 	assert.EqualValues(t, expectedQuery, query)
 }
 
-func TestGetDataFromTableOK(t *testing.T) {
+func TestQueryTableDataOK(t *testing.T) {
 	config, err := configs.GetConf("../config.yaml")
 	assert.NoError(t, err, "error creating config: %v", err)
 	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
@@ -111,29 +68,34 @@ func TestGetDataFromTableOK(t *testing.T) {
 	assert.NoError(t, err, "error creating database transaction: %v", err)
 
 	tableName := "tableName"
-
-	mock.ExpectQuery(fmt.Sprintf(stmtGetTableColumns, tableName, conn.config.DBName)).
-		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE"}).
-			AddRow("id", "int").
-			AddRow("email", "string").
-			AddRow("name", "string"))
+	columns := []tableColumn{{Name: "id", DataType: "int"}, {Name: "email", DataType: "string"}, {Name: "name", DataType: "string"}}
 
 	rows := sqlmock.NewRows([]string{"id", "email", "name"}).
 		AddRow(1, nil, "Test Name 1").
 		AddRow(2, "test2@test.de", "Test Name 2").
 		AddRow(3, "", "Test Name 3")
 
-	mock.ExpectPrepare("SELECT `id`, `email`, `name` FROM `tableName`").ExpectQuery().WillReturnRows(rows)
+	mock.ExpectQuery("SELECT `id`, `email`, `name` FROM `tableName` ORDER BY `id`").WillReturnRows(rows)
 
-	results, columns, err := getDataFromTable(ctx, conn, tableName)
+	sqlRows, err := queryTableData(ctx, conn, tableName, columns, []string{"id"}, "")
 	assert.NoError(t, err, "error getting data from table: %v", err)
+	defer sqlRows.Close()
 
-	expectedResults := []string{"1,nil,Test Name 1", "2,test2@test.de,Test Name 2", "3,,Test Name 3"}
-	expectedColmns := []string{"id", "email", "name"}
+	src := &sqlRowSource{rows: sqlRows, columns: len(columns)}
+	results := []string{}
+	for {
+		row, err := src.next()
+		assert.NoError(t, err, "error reading row: %v", err)
+		if row == nil {
+			break
+		}
+		results = append(results, fmt.Sprintf("%s,%s,%s", valueToString(row[0]), valueToString(row[1]), valueToString(row[2])))
+	}
 
+	expectedResults := []string{"1,nil,Test Name 1", "2,test2@test.de,Test Name 2", "3,,Test Name 3"}
 	assert.EqualValues(t, expectedResults, results)
-	assert.EqualValues(t, expectedColmns, columns)
 }
+
 func TestGetTablesOK(t *testing.T) {
 	config, err := configs.GetConf("../config.yaml")
 	assert.NoError(t, err, "error creating config: %v", err)
@@ -166,3 +128,225 @@ func TestGetTablesOK(t *testing.T) {
 	}
 	assert.EqualValues(t, expectedResults, conn.tables)
 }
+
+func TestCompareDataMatchByKey(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	conn1, mock1, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+	conn2, mock2, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+
+	mock1.ExpectBegin()
+	conn1.tx, err = conn1.connection.BeginTx(ctx, &sql.TxOptions{})
+	assert.NoError(t, err, "error creating database transaction: %v", err)
+	mock2.ExpectBegin()
+	conn2.tx, err = conn2.connection.BeginTx(ctx, &sql.TxOptions{})
+	assert.NoError(t, err, "error creating database transaction: %v", err)
+
+	tableName := "tableName"
+	conn1.tables = []fullTable{{Name: tableName, Type: tableTypeBaseTable}}
+	conn2.tables = []fullTable{{Name: tableName, Type: tableTypeBaseTable}}
+
+	for _, mock := range []sqlmock.Sqlmock{mock1, mock2} {
+		mock.ExpectQuery(fmt.Sprintf(stmtGetTableColumns, tableName, "")).
+			WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE"}).
+				AddRow("id", "int").
+				AddRow("name", "string"))
+	}
+	mock1.ExpectQuery("SELECT INDEX_NAME, COLUMN_NAME").
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME", "NULLABLE"}).
+			AddRow("PRIMARY", "id", 0))
+	mock1.ExpectQuery("SELECT `id`, `name` FROM `tableName` ORDER BY `id`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+			AddRow(1, "a").
+			AddRow(2, "b").
+			AddRow(3, "c").
+			AddRow(10, "d"))
+	mock2.ExpectQuery("SELECT `id`, `name` FROM `tableName` ORDER BY `id`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+			AddRow(1, "x").
+			AddRow(3, "c").
+			AddRow(4, nil).
+			AddRow(10, "d"))
+
+	result := newComparisonResult("label1", "label2")
+	err = compareData(ctx, conn1, conn2, result)
+	assert.NoError(t, err, "error comparing data: %v", err)
+
+	assert.True(t, result.hasDifferences())
+	assert.Len(t, result.Tables, 1)
+
+	table := result.Tables[0]
+	assert.EqualValues(t, []string{"id"}, table.Key)
+	assert.EqualValues(t, 4, table.Rows1)
+	assert.EqualValues(t, 4, table.Rows2)
+	assert.EqualValues(t, 1, table.OnlyIn1)
+	assert.EqualValues(t, 1, table.OnlyIn2)
+	assert.EqualValues(t, 1, table.Changed)
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("id", "1"), Values: []valueDifference{{Column: "name", Value1: strPtr("a"), Value2: strPtr("x")}}},
+		{Type: rowOnlyIn1, Key: testKey("id", "2")},
+		{Type: rowOnlyIn2, Key: testKey("id", "4")},
+	}, table.Rows)
+}
+
+func TestMakeQueryGetTableDataPostgres(t *testing.T) {
+	columns := []tableColumn{{Name: "id", DataType: "integer"}, {Name: "name", DataType: "text"}}
+
+	query := makeQueryGetTableData(postgresEngine{}, "tableName", columns, []string{"id"}, "")
+	expectedQuery := `SELECT CAST("id" AS TEXT), CAST("name" AS TEXT) FROM "tableName" ORDER BY "id" NULLS FIRST`
+	assert.EqualValues(t, expectedQuery, query)
+
+	query = makeQueryGetTableData(postgresEngine{}, "tableName", columns, nil, "")
+	expectedQuery = `SELECT CAST("id" AS TEXT), CAST("name" AS TEXT) FROM "tableName" ORDER BY "id" NULLS FIRST, CAST("name" AS TEXT) COLLATE "C" NULLS FIRST`
+	assert.EqualValues(t, expectedQuery, query)
+}
+
+func TestBeginSnapshotMySQL(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.SnapshotPosition = true
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	conn, mock, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+
+	mock.ExpectExec(stmtSetSnapshotIsolation).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(stmtStartConsistentSnapshot + ", READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(stmtGetBinlogPosition).
+		WillReturnRows(sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("mysql-bin.000003", 154, "", "", "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n4f22fa47-71ca-11e1-9e33-c80aa9429562:1-2"))
+	err = conn.begin(ctx)
+	assert.NoError(t, err, "error beginning transaction: %v", err)
+	assert.EqualValues(t, "binlog mysql-bin.000003:154, gtid 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4f22fa47-71ca-11e1-9e33-c80aa9429562:1-2", conn.position)
+
+	// The session is reset before the connection goes back to the pool
+	mock.ExpectExec(stmtRollback).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(stmtResetSession).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, conn.tx.Rollback())
+	assert.ErrorIs(t, conn.tx.Rollback(), sql.ErrTxDone)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBeginTimeZoneMySQL(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.TimeZone = "+00:00"
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	conn, mock, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+
+	mock.ExpectExec(stmtSetSnapshotIsolation).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(stmtStartConsistentSnapshot + ", READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("SET time_zone = '+00:00'")).WillReturnResult(sqlmock.NewResult(0, 0))
+	err = conn.begin(ctx)
+	assert.NoError(t, err, "error beginning transaction: %v", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBeginParallelMySQL(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.Parallelism = 2
+	config.SnapshotPosition = true
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	conn, mock, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+
+	// The transactions of the workers are begun along with the main one while writes are locked, and so is
+	// the position of the snapshot read
+	mock.ExpectExec(stmtLockWrites).WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i < 3; i++ {
+		mock.ExpectExec(stmtSetSnapshotIsolation).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(stmtStartConsistentSnapshot + ", READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+		if i == 0 {
+			mock.ExpectQuery(stmtGetBinlogPosition).
+				WillReturnRows(sqlmock.NewRows([]string{"File", "Position"}).AddRow("mysql-bin.000003", 154))
+		}
+	}
+	mock.ExpectExec(stmtUnlockWrites).WillReturnResult(sqlmock.NewResult(0, 0))
+	err = conn.begin(ctx)
+	assert.NoError(t, err, "error beginning transaction: %v", err)
+	assert.Len(t, conn.snapshots, 2)
+	assert.EqualValues(t, "binlog mysql-bin.000003:154", conn.position)
+
+	// Workers take those transactions and give them back when released, without sending anything
+	w, err := conn.worker(ctx)
+	assert.NoError(t, err, "error creating worker: %v", err)
+	assert.Len(t, conn.snapshots, 1)
+	assert.NoError(t, conn.release(w))
+	assert.Len(t, conn.snapshots, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBeginParallelMySQLNoLock(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.Parallelism = 2
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	conn, mock, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+
+	// Without the RELOAD privilege, each worker begins its own transaction
+	mock.ExpectExec(stmtLockWrites).WillReturnError(fmt.Errorf("Access denied; you need the RELOAD privilege"))
+	mock.ExpectExec(stmtSetSnapshotIsolation).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(stmtStartConsistentSnapshot + ", READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	err = conn.begin(ctx)
+	assert.NoError(t, err, "error beginning transaction: %v", err)
+	assert.Empty(t, conn.snapshots)
+
+	mock.ExpectExec(stmtSetSnapshotIsolation).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(stmtStartConsistentSnapshot + ", READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = conn.worker(ctx)
+	assert.NoError(t, err, "error creating worker: %v", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBeginTimeZonePostgres(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.TimeZone = "Europe/Madrid"
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	conn, mock, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+	conn.engine = postgresEngine{}
+
+	// Workers read the exported snapshot, in the same time zone
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SET LOCAL TIME ZONE 'Europe/Madrid'")).WillReturnResult(sqlmock.NewResult(0, 0))
+	err = conn.begin(ctx)
+	assert.NoError(t, err, "error beginning transaction: %v", err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(stmtPostgresExportSnapshot)).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_export_snapshot"}).AddRow("00000003-0000001B-1"))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SET TRANSACTION SNAPSHOT '00000003-0000001B-1'")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("SET LOCAL TIME ZONE 'Europe/Madrid'")).WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = conn.worker(ctx)
+	assert.NoError(t, err, "error creating worker: %v", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBeginTimeZoneSQLite(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.TimeZone = "+00:00"
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	conn, mock, err := getMockData(ctx)
+	assert.NoError(t, err, "error creating mock: %v", err)
+	conn.engine = sqliteEngine{}
+
+	// SQLite has no time zones, nothing but the transaction is sent
+	mock.ExpectBegin()
+	err = conn.begin(ctx)
+	assert.NoError(t, err, "error beginning transaction: %v", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runStrategyLiveDump compares database1, read live, with the Ncsv files inside dir2 (e.g. a dump of another
+// database taken earlier), so only one of the sides has to be dumped.
+func runStrategyLiveDump(ctx context.Context) error {
+	config := getConfigFromContext(ctx)
+	// Check if dir2 exists
+	if err := isDirValid(config.Dir2); err != nil {
+		return err
+	}
+
+	// Connect to database
+	db, err := openDatabaseConnection(ctx, config.Database1)
+	if err != nil {
+		return err
+	}
+	defer db.connection.Close()
+
+	// Compare database with dir2
+	result, err := compareDatabaseDir(ctx, db, config.Dir2)
+	if db.tx != nil {
+		db.tx.Rollback()
+	}
+	if err != nil {
+		return err
+	}
+
+	// Show every difference found
+	if err := result.write(os.Stdout, config.GetOutput(), config.Detailed); err != nil {
+		return err
+	}
+	if result.hasDifferences() {
+		return ErrDifferencesFound
+	}
+
+	return nil
+}
+
+// compareDatabaseDir compares the tables of given database with the Ncsv files inside dir and returns
+// every difference found. Tables are paired with the files by name.
+func compareDatabaseDir(ctx context.Context, db *databaseConn, dir string) (*comparisonResult, error) {
+	config := getConfigFromContext(ctx)
+
+	// Begin transaction, so every table is read from the same snapshot
+	if err := db.begin(ctx); err != nil {
+		return nil, err
+	}
+	result := newComparisonResult(config.Database1.Label, dir)
+	result.Position1 = db.position
+
+	// Get tables from the database and the dir
+	if err := db.getTables(ctx); err != nil {
+		return nil, err
+	}
+	tables2, err := getNcsvTables(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	inDir := make(map[string]bool, len(tables2))
+	for _, t := range tables2 {
+		inDir[t] = true
+	}
+	inDatabase := make(map[string]bool, len(db.tables))
+	for _, t := range db.tables {
+		inDatabase[t.Name] = true
+		if !inDir[t.Name] {
+			result.TablesOnlyIn1 = append(result.TablesOnlyIn1, t.Name)
+		}
+	}
+	for _, t := range tables2 {
+		if !inDatabase[t] {
+			result.TablesOnlyIn2 = append(result.TablesOnlyIn2, t)
+		}
+	}
+
+	// Compare the tables existing in both
+	err = forEachTable(ctx, len(db.tables), []*databaseConn{db}, func(ctx context.Context, dbs []*databaseConn, i int) error {
+		table := db.tables[i].Name
+		if !inDir[table] {
+			return nil
+		}
+		if err := compareTableNcsv(ctx, dbs[0], dir, table, result); err != nil {
+			return fmt.Errorf("table %s: %v", table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("data error: %w", err)
+	}
+
+	// Tables may have been compared in any order, report them in the order of the database
+	result.sortTables(tableNames(db.tables))
+
+	return result, nil
+}
+
+// compareTableNcsv compares the data of given table with its Ncsv file inside dir, registering the differences in result.
+//
+// Rows are matched as in compareTableData, and the columns of the file are paired by name with the columns
+// of the table as in compareNcsvs. If the file was not written ordered by the key of the table (e.g. the key
+// changed or the file has no schema file), its rows are read into memory and ordered before being merged.
+func compareTableNcsv(ctx context.Context, db *databaseConn, dir, table string, result *comparisonResult) error {
+	// Get columns of the table
+	columns1, err := getTableColumns(ctx, db, table)
+	if err != nil && !errors.Is(err, errNoColumns) {
+		return err
+	}
+
+	// Get columns of the file, with the data types of the table if it has no schema file
+	schema2, err := readNcsvSchema(dir, table)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(ncsvPath(dir, table))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader2, err := newNcsvReader(file)
+	if err != nil && !errors.Is(err, errNoColumns) {
+		return err
+	}
+	columns2 := getNcsvColumns(ctx, table, reader2, schema2, &ncsvSchema{Columns: columns1})
+	if len(columns1) == 0 && len(columns2) == 0 {
+		return nil
+	}
+
+	// Rows can only be compared if both have the same columns
+	tableResult := result.table(table)
+	columns2, ok := pairColumns(columns1, columns2, nil, false)
+	if !ok {
+		tableResult.Schema = []string{fmt.Sprintf("table %s columns don't match", table)}
+		return nil
+	}
+	if !equalColumns(columns1, columns2) {
+		tableResult.Schema = []string{fmt.Sprintf("table %s column types don't match", table)}
+	}
+
+	// Get the columns used to match the rows
+	key, err := getTableKey(ctx, db, table, columnNames(columns1))
+	if err != nil {
+		return err
+	}
+	tableResult.Key = key
+	layout := newRowLayout(columns1, key)
+	if err := layout.configure(getConfigFromContext(ctx), table); err != nil {
+		return err
+	}
+
+	// Only the rows of the table are filtered, the rows of the file were filtered when it was written
+	where := getConfigFromContext(ctx).GetTableFilter(table)
+	tableResult.Filter = where
+	rows1, err := queryTableData(ctx, db, table, columns1, key, where)
+	if err != nil {
+		return err
+	}
+	defer rows1.Close()
+
+	var src1, src2 rowSource
+	src1 = &sqlRowSource{rows: rows1, columns: len(columns1)}
+	src2 = &projectedRowSource{src: reader2, idx: columnIndexes(reader2.columns, columnNames(columns1))}
+	if key == nil || schema2 == nil || strings.Join(key, ",") != strings.Join(schema2.Key, ",") {
+		if src2, err = sortedRowSource(src2, layout); err != nil {
+			return err
+		}
+	}
+
+	return mergeRows(getConfigFromContext(ctx).GetLimit(), tableResult, layout, src1, src2, nil)
+}
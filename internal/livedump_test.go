@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"go-db-compare/configs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareDatabaseDir(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)",
+		"CREATE TABLE tags (code TEXT PRIMARY KEY, label TEXT)",
+		"CREATE TABLE logs (id INTEGER PRIMARY KEY)",
+		"INSERT INTO users VALUES (1, 'a'), (2, 'b'), (3, 'c')",
+		"INSERT INTO tags VALUES ('x', 'one'), ('y', 'two')")
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	db, err := openDatabaseConnection(ctx, config.Database1)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db.connection.Close()
+
+	// Dump the database, then change it as if the dump was taken earlier
+	dir := t.TempDir()
+	assert.NoError(t, createNcsvs(ctx, db, dir))
+	db.tx.Rollback()
+	for _, statement := range []string{"UPDATE users SET name = 'x' WHERE id = 2", "DELETE FROM users WHERE id = 3", "DROP TABLE logs"} {
+		_, err := db.connection.Exec(statement)
+		assert.NoError(t, err, "error executing %s: %v", statement, err)
+	}
+
+	// Files without a schema file are ordered before being compared
+	assert.NoError(t, os.Remove(ncsvSchemaPath(dir, "tags")))
+	writeTestNcsv(t, dir, "tags", nil, []string{"label", "code"}, [][]*string{
+		{strPtr("two"), strPtr("y")},
+		{strPtr("one"), strPtr("x")},
+	})
+
+	result, err := compareDatabaseDir(ctx, db, dir)
+	assert.NoError(t, err, "error comparing database with dir: %v", err)
+	assert.NoError(t, db.tx.Rollback())
+
+	assert.EqualValues(t, []string{"logs"}, result.TablesOnlyIn2)
+	assert.Len(t, result.Tables, 2)
+
+	tags := result.Tables[0]
+	assert.EqualValues(t, "tags", tags.Table)
+	assert.False(t, tags.hasDifferences())
+	assert.EqualValues(t, 2, tags.Rows2)
+
+	users := result.Tables[1]
+	assert.EqualValues(t, "users", users.Table)
+	assert.EqualValues(t, []string{"id"}, users.Key)
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("id", "2"), Values: []valueDifference{{Column: "name", Value1: strPtr("x"), Value2: strPtr("b")}}},
+		{Type: rowOnlyIn2, Key: testKey("id", "3")},
+	}, users.Rows)
+}
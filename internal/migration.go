@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tableChanges holds what has to change in the current definition of a table (database2) to match
+// its target definition (database1).
+type tableChanges struct {
+	table   string
+	target  *tableSchema
+	current *tableSchema
+
+	// columns holds the columns to add or modify, in the order of target.
+	columns     []columnChange
+	dropColumns []string
+
+	// primaryKey is true if the primary key has to change.
+	primaryKey bool
+
+	// Elements whose definition changed are dropped and added again.
+	addIndexes      []schemaElement
+	dropIndexes     []schemaElement
+	addForeignKeys  []schemaElement
+	dropForeignKeys []schemaElement
+	addChecks       []schemaElement
+	dropChecks      []schemaElement
+	setOptions      []schemaElement
+	resetOptions    []schemaElement
+}
+
+// columnChange holds a column to add or modify.
+type columnChange struct {
+	target schemaColumn
+	// current holds the current definition of the column, nil if the column has to be added.
+	current *schemaColumn
+	// after holds the column that precedes the column in target, empty if it is the first one.
+	after string
+	// moved is true if the column has to change its position.
+	moved bool
+}
+
+// newTableChanges returns the changes turning the table defined by current into the table defined by target.
+func newTableChanges(table string, target, current *tableSchema) *tableChanges {
+	changes := &tableChanges{table: table, target: target, current: current}
+
+	// Columns, whose positions are compared among the columns existing in both tables
+	currentColumns := make(map[string]*schemaColumn, len(current.columns))
+	var currentOrder []string
+	for i, c := range current.columns {
+		currentColumns[c.name] = &current.columns[i]
+	}
+	targetColumns := make(map[string]bool, len(target.columns))
+	for _, c := range target.columns {
+		targetColumns[c.name] = true
+	}
+	for _, c := range current.columns {
+		if targetColumns[c.name] {
+			currentOrder = append(currentOrder, c.name)
+		} else {
+			changes.dropColumns = append(changes.dropColumns, c.name)
+		}
+	}
+
+	common := 0
+	for i, c := range target.columns {
+		change := columnChange{target: c, current: currentColumns[c.name]}
+		if i > 0 {
+			change.after = target.columns[i-1].name
+		}
+
+		if change.current != nil {
+			change.moved = currentOrder[common] != c.name
+			common++
+			if !change.moved && c == *change.current {
+				continue
+			}
+		}
+		changes.columns = append(changes.columns, change)
+	}
+
+	changes.primaryKey = strings.Join(target.primaryKey, ",") != strings.Join(current.primaryKey, ",")
+
+	changes.addIndexes, changes.dropIndexes = diffElementChanges(target.indexes, current.indexes)
+	changes.addForeignKeys, changes.dropForeignKeys = diffElementChanges(target.foreignKeys, current.foreignKeys)
+	changes.addChecks, changes.dropChecks = diffElementChanges(target.checks, current.checks)
+	changes.setOptions, changes.resetOptions = diffElementChanges(target.options, current.options)
+	// Options are set without being removed first
+	var resetOptions []schemaElement
+	for _, o := range changes.resetOptions {
+		if !containsElement(target.options, o.name) {
+			resetOptions = append(resetOptions, o)
+		}
+	}
+	changes.resetOptions = resetOptions
+
+	return changes
+}
+
+// diffElementChanges returns the elements of target that have to be added to current, and the
+// elements of current that have to be dropped. Elements whose definition changed are in both.
+func diffElementChanges(target, current []schemaElement) ([]schemaElement, []schemaElement) {
+	var add, drop []schemaElement
+
+	definitions := make(map[string]string, len(current))
+	for _, e := range current {
+		definitions[e.name] = e.definition
+	}
+	for _, e := range target {
+		if definition, ok := definitions[e.name]; !ok || definition != e.definition {
+			add = append(add, e)
+		}
+	}
+
+	definitions = make(map[string]string, len(target))
+	for _, e := range target {
+		definitions[e.name] = e.definition
+	}
+	for _, e := range current {
+		if definition, ok := definitions[e.name]; !ok || definition != e.definition {
+			drop = append(drop, e)
+		}
+	}
+
+	return add, drop
+}
+
+// containsElement returns true if an element with given name is in elements.
+func containsElement(elements []schemaElement, name string) bool {
+	for _, e := range elements {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaMigration returns the statements turning the schema of database2 into the schema of database1,
+// in the dialect of database2. Tables are paired as when comparing them (see pairTables): tables only in
+// database1 are created, tables only in database2 are dropped and tables in both are altered. Views that
+// differ are dropped and created.
+//
+// Tables and columns renamed in database2 through the mappings of the config are renamed back to their
+// names in database1 before being altered, so their data is kept.
+func schemaMigration(ctx context.Context, db1 *databaseConn, db2 *databaseConn) ([]string, error) {
+	var statements []string
+	config := getConfigFromContext(ctx)
+
+	pairs, _, only2 := pairTables(ctx, db1, db2)
+	tables2 := make(map[string]fullTable, len(pairs))
+	for _, p := range pairs {
+		tables2[p.table1.Name] = p.table2
+	}
+
+	for _, t1 := range db1.tables {
+		schema1, err := db1.getTableSchema(ctx, t1)
+		if err != nil {
+			return nil, err
+		}
+
+		t2, ok := tables2[t1.Name]
+		if !ok {
+			statements = append(statements, db2.engine.createTableStatements(t1.Name, schema1)...)
+			continue
+		}
+		schema2, err := db2.getTableSchema(ctx, t2)
+		if err != nil {
+			return nil, err
+		}
+
+		if t1.Type == tableTypeView || t2.Type == tableTypeView {
+			if t1.Type != t2.Type || schema1.view != schema2.view || t1.Name != t2.Name {
+				statements = append(statements, dropTableStatement(db2.engine, t2))
+				statements = append(statements, db2.engine.createTableStatements(t1.Name, schema1)...)
+			}
+			continue
+		}
+
+		if t1.Name != t2.Name {
+			statements = append(statements, renameTableStatement(db2.engine, t2.Name, t1.Name))
+		}
+		for _, c := range schema2.columns {
+			if name1 := config.GetColumnName1(t1.Name, c.name); name1 != c.name {
+				statements = append(statements, renameColumnStatement(db2.engine, t1.Name, c.name, name1))
+			}
+		}
+		schema2 = schema2.renameColumns(func(column string) string {
+			return config.GetColumnName1(t1.Name, column)
+		})
+
+		statements = append(statements, db2.engine.alterTableStatements(newTableChanges(t1.Name, schema1, schema2))...)
+	}
+
+	for _, t2 := range only2 {
+		statements = append(statements, dropTableStatement(db2.engine, t2))
+	}
+
+	return statements, nil
+}
+
+// renameTableStatement returns the statement renaming given table.
+func renameTableStatement(e engine, table, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s", e.quote(table), e.quote(name))
+}
+
+// renameColumnStatement returns the statement renaming given column of given table.
+func renameColumnStatement(e engine, table, column, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", e.quote(table), e.quote(column), e.quote(name))
+}
+
+// dropTableStatement returns the statement dropping given table or view.
+func dropTableStatement(e engine, table fullTable) string {
+	if table.Type == tableTypeView {
+		return "DROP VIEW " + e.quote(table.Name)
+	}
+	return "DROP TABLE " + e.quote(table.Name)
+}
+
+// writeSchemaMigration writes to path the statements turning the schema of database2 into the
+// schema of database1 (see schemaMigration), so they can be reviewed before being run.
+func writeSchemaMigration(ctx context.Context, db1 *databaseConn, db2 *databaseConn, path string) error {
+	statements, err := schemaMigration(ctx, db1, db2)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	config := getConfigFromContext(ctx)
+	fmt.Fprintf(w, "-- Statements turning the schema of %s into the schema of %s\n", config.Database2.Label, config.Database1.Label)
+	for _, statement := range statements {
+		// Changes that can't be done with a statement are written as comments
+		if strings.HasPrefix(statement, "--") {
+			fmt.Fprintf(w, "%s\n", statement)
+			continue
+		}
+		fmt.Fprintf(w, "%s;\n", statement)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
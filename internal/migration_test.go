@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"go-db-compare/configs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlterTableStatementsMySQL(t *testing.T) {
+	target, err := parseMySQLCreateTable(testMySQLCreateTable)
+	assert.NoError(t, err, "error parsing table: %v", err)
+	current, err := parseMySQLCreateTable("CREATE TABLE `products` (\n" +
+		"  `id` int unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `price` decimal(12,2) DEFAULT NULL COMMENT 'price, in euros',\n" +
+		"  `name` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL DEFAULT 'a b',\n" +
+		"  `stock` int NOT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx_name` (`name`),\n" +
+		"  CONSTRAINT `chk_price` CHECK ((`price` > 0))\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=COMPRESSED")
+	assert.NoError(t, err, "error parsing table: %v", err)
+
+	statements := mysqlEngine{}.alterTableStatements(newTableChanges("products", target, current))
+	assert.EqualValues(t, []string{
+		"ALTER TABLE `products` DROP INDEX `idx_name`",
+		"ALTER TABLE `products` DROP COLUMN `stock`",
+		"ALTER TABLE `products` MODIFY COLUMN `name` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL DEFAULT 'a b' AFTER `id`",
+		"ALTER TABLE `products` MODIFY COLUMN `price` decimal(10,2) NULL DEFAULT NULL COMMENT 'price, in euros' AFTER `name`",
+		"ALTER TABLE `products` ADD COLUMN `category_id` int NULL DEFAULT NULL AFTER `price`",
+		"ALTER TABLE `products` ADD UNIQUE KEY `idx_name` (`name`)",
+		"ALTER TABLE `products` ADD KEY `idx_category` (`category_id`,`price`)",
+		"ALTER TABLE `products` ADD CONSTRAINT `fk_category` FOREIGN KEY (`category_id`) REFERENCES `categories` (`id`) ON DELETE CASCADE",
+		"ALTER TABLE `products` COMMENT='all products'",
+		"-- option ROW_FORMAT of table products must be removed manually",
+	}, statements)
+
+	// Nothing to change
+	assert.Empty(t, mysqlEngine{}.alterTableStatements(newTableChanges("products", target, target)))
+}
+
+func TestWriteSchemaMigrationSQLite(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT)",
+		"CREATE INDEX idx_email ON users (email)",
+		"CREATE TABLE tags (code TEXT NOT NULL, label TEXT)",
+		"CREATE TABLE clients (id INTEGER PRIMARY KEY, name TEXT)")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+		"CREATE TABLE old (id INTEGER)",
+		"CREATE TABLE customers (id INTEGER PRIMARY KEY, full_name TEXT)")
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	db1, err := openDatabaseConnection(ctx, config.Database1)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db1.connection.Close()
+	db2, err := openDatabaseConnection(ctx, config.Database2)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db2.connection.Close()
+	_, err = compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	path := filepath.Join(t.TempDir(), "schemadiff.sql")
+	err = writeSchemaMigration(ctx, db1, db2, path)
+	assert.NoError(t, err, "error writing schema migration: %v", err)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err, "error reading schema migration: %v", err)
+	// Tables and columns mapped in the config (clients is customers in database2, its column name is full_name)
+	// are renamed instead of being dropped and created
+	assert.EqualValues(t, "-- Statements turning the schema of "+config.Database2.Label+" into the schema of "+config.Database1.Label+"\n"+
+		"ALTER TABLE \"customers\" RENAME TO \"clients\";\n"+
+		"ALTER TABLE \"clients\" RENAME COLUMN \"full_name\" TO \"name\";\n"+
+		"CREATE TABLE tags (code TEXT NOT NULL, label TEXT);\n"+
+		"ALTER TABLE \"users\" ADD COLUMN \"email\" TEXT;\n"+
+		"CREATE INDEX \"idx_email\" ON \"users\" (email);\n"+
+		"-- table users must be rebuilt to change: column name\n"+
+		"DROP TABLE \"old\";\n", string(content))
+}
@@ -0,0 +1,499 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go-db-compare/configs"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	stmtGetAllTables        = "SHOW FULL TABLES"
+	stmtGetTableInformation = "SHOW CREATE TABLE %s "
+	stmtGetTableColumns     = `SELECT COLUMN_NAME, DATA_TYPE
+	FROM INFORMATION_SCHEMA.COLUMNS
+	WHERE TABLE_NAME = '%s' AND TABLE_SCHEMA = '%s';`
+	stmtSetSnapshotIsolation    = "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ"
+	stmtStartConsistentSnapshot = "START TRANSACTION WITH CONSISTENT SNAPSHOT"
+	stmtCommit                  = "COMMIT"
+	stmtRollback                = "ROLLBACK"
+	// stmtResetSession restores the session variables that may be set while reading (see setTimeZone)
+	stmtResetSession      = "SET SESSION time_zone = DEFAULT"
+	stmtGetBinlogPosition = "SHOW MASTER STATUS"
+	stmtSetTimeZone       = "SET time_zone = %s"
+	stmtLockWrites        = "FLUSH TABLES WITH READ LOCK"
+	stmtUnlockWrites      = "UNLOCK TABLES"
+	// stmtGetBinlogPositionNew replaces stmtGetBinlogPosition since MySQL 8.4
+	stmtGetBinlogPositionNew = "SHOW BINARY LOG STATUS"
+	stmtGetTableKeys         = `SELECT INDEX_NAME, COLUMN_NAME, NULLABLE = 'YES'
+	FROM INFORMATION_SCHEMA.STATISTICS
+	WHERE TABLE_NAME = '%s' AND TABLE_SCHEMA = '%s' AND NON_UNIQUE = 0
+	ORDER BY INDEX_NAME = 'PRIMARY' DESC, INDEX_NAME, SEQ_IN_INDEX;`
+)
+
+// autoIncrementOption matches the AUTO_INCREMENT option in SHOW CREATE TABLE.
+var autoIncrementOption = regexp.MustCompile(`AUTO_INCREMENT=\d+ ?`)
+
+// mysqlValueReplacer escapes the characters of a string literal, as mysql_real_escape_string does.
+var mysqlValueReplacer = strings.NewReplacer(`\`, `\\`, "'", `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
+// mysqlEngine is the engine for MySQL databases.
+type mysqlEngine struct{}
+
+func (mysqlEngine) driverName() string {
+	return engineMySQL
+}
+
+// dataSourceName only allows sending several statements at once to writable connections, where strategy
+// sync sends its statements in batches, so that nothing else can be made to run more than one statement.
+func (mysqlEngine) dataSourceName(dbConfig *configs.Database, writable bool) string {
+	config := mysql.NewConfig()
+	config.User = dbConfig.Username
+	config.Passwd = dbConfig.Password
+	config.DBName = dbConfig.Database
+	config.Net = "tcp"
+	config.Addr = fmt.Sprintf("%s:%s", dbConfig.Host, dbConfig.Port)
+	config.MultiStatements = writable
+	return config.FormatDSN()
+}
+
+func (mysqlEngine) namespace(dbConfig *configs.Database) string {
+	return dbConfig.Database
+}
+
+func (mysqlEngine) quote(identifier string) string {
+	return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+}
+
+func (mysqlEngine) placeholder(n int) string {
+	return "?"
+}
+
+// quoteValue escapes backslashes and the characters that can't be written as they are, as the
+// literal may hold any bytes (e.g. the values of binary columns).
+func (mysqlEngine) quoteValue(value string) string {
+	return "'" + mysqlValueReplacer.Replace(value) + "'"
+}
+
+func (mysqlEngine) stmtGetAllTables() string {
+	return stmtGetAllTables
+}
+
+func (mysqlEngine) stmtGetTableColumns() string {
+	return stmtGetTableColumns
+}
+
+func (mysqlEngine) stmtGetTableKeys() string {
+	return stmtGetTableKeys
+}
+
+// beginSnapshot begins a transaction WITH CONSISTENT SNAPSHOT on a connection of its own, as database/sql
+// can't begin it that way. The isolation level is only set for that transaction, and the session is reset
+// once the transaction finishes (see mysqlTx).
+func (mysqlEngine) beginSnapshot(ctx context.Context, db *sql.DB, writable bool, snapshot string) (dbTx, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start := stmtStartConsistentSnapshot
+	if !writable {
+		start += ", READ ONLY"
+	}
+	for _, statement := range []string{stmtSetSnapshotIsolation, start} {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			discardConn(conn)
+			return nil, err
+		}
+	}
+
+	return &mysqlTx{Conn: conn}, nil
+}
+
+// mysqlTx is a transaction begun through the statements sent to a connection of its own (see
+// mysqlEngine.beginSnapshot). Once the transaction finishes, the session is reset (see stmtResetSession)
+// and the connection is returned to the pool.
+type mysqlTx struct {
+	*sql.Conn
+	done bool
+}
+
+func (tx *mysqlTx) Commit() error {
+	return tx.finish(stmtCommit)
+}
+
+func (tx *mysqlTx) Rollback() error {
+	return tx.finish(stmtRollback)
+}
+
+// finish finishes the transaction with given statement. Returns sql.ErrTxDone if the transaction
+// already finished, as *sql.Tx does. If the session can't be reset, the connection is discarded.
+func (tx *mysqlTx) finish(statement string) error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+
+	ctx := context.Background()
+	for _, s := range []string{statement, stmtResetSession} {
+		if _, err := tx.ExecContext(ctx, s); err != nil {
+			discardConn(tx.Conn)
+			return err
+		}
+	}
+	return tx.Close()
+}
+
+// discardConn closes given connection without returning it to the pool, e.g. when its session is unknown.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	conn.Close()
+}
+
+// exportSnapshot returns an empty id, as MySQL can't share snapshots between connections.
+func (mysqlEngine) exportSnapshot(ctx context.Context, tx dbTx) (string, error) {
+	return "", nil
+}
+
+// lockWrites takes the global read lock on a connection of its own, which requires the RELOAD privilege.
+// Taking the lock waits for the running queries to finish, as FLUSH TABLES closes every table.
+func (mysqlEngine) lockWrites(ctx context.Context, db *sql.DB) (func() error, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, stmtLockWrites); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), stmtUnlockWrites)
+		return err
+	}, nil
+}
+
+// setTimeZone sets the time zone of the session, which TIMESTAMP values are converted to.
+// Named zones require the time zone tables to be loaded, offsets like +00:00 are always supported.
+func (e mysqlEngine) setTimeZone(ctx context.Context, tx dbTx, zone string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(stmtSetTimeZone, e.quoteValue(zone)))
+	return err
+}
+
+// snapshotPosition returns the binlog file and position, and the executed GTID set if GTIDs are enabled,
+// e.g. "binlog mysql-bin.000003:154, gtid 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5". MySQL can't tell the
+// position of a snapshot, so it is read right after the snapshot is taken. Returns an empty position if the
+// binlog is disabled.
+func (mysqlEngine) snapshotPosition(ctx context.Context, tx dbTx) (string, error) {
+	rows, err := tx.QueryContext(ctx, stmtGetBinlogPosition)
+	if err != nil {
+		rows, err = tx.QueryContext(ctx, stmtGetBinlogPositionNew)
+		if err != nil {
+			return "", err
+		}
+	}
+	defer rows.Close()
+
+	// The columns are File, Position, Binlog_Do_DB, Binlog_Ignore_DB and Executed_Gtid_Set
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	src := &sqlRowSource{rows: rows, columns: len(columns)}
+	row, err := src.next()
+	if err != nil || row == nil || len(row) < 2 {
+		return "", err
+	}
+
+	position := fmt.Sprintf("binlog %s:%s", valueToString(row[0]), valueToString(row[1]))
+	if len(row) >= 5 && row[4] != nil && *row[4] != "" {
+		position += ", gtid " + strings.ReplaceAll(*row[4], "\n", "")
+	}
+	return position, nil
+}
+
+// getTableSchema returns the definition of given table parsed from SHOW CREATE TABLE (see parseMySQLCreateTable).
+// For views, the definition of the view is returned.
+func (e mysqlEngine) getTableSchema(ctx context.Context, tx dbTx, namespace string, table fullTable) (*tableSchema, error) {
+	var tableSQL, doesntMatter sql.NullString
+	// We expect to have two fields from the select if the table type is tableTypeBaseTable.
+	// If this table type is actually tableTypeView, we expect to have four fields from the select.
+	row := tx.QueryRowContext(ctx, fmt.Sprintf(stmtGetTableInformation, e.quote(table.Name)))
+	if table.Type == tableTypeView {
+		if err := row.Scan(&doesntMatter, &tableSQL, &doesntMatter, &doesntMatter); err != nil {
+			return nil, err
+		}
+		return &tableSchema{view: tableSQL.String}, nil
+	}
+
+	if err := row.Scan(&doesntMatter, &tableSQL); err != nil {
+		return nil, err
+	}
+	return parseMySQLCreateTable(tableSQL.String)
+}
+
+func (e mysqlEngine) createTableStatements(table string, schema *tableSchema) []string {
+	if schema.view != "" {
+		return []string{schema.view}
+	}
+	return []string{schema.create}
+}
+
+// alterTableStatements returns one ALTER TABLE statement for each change. Foreign keys, checks and
+// indexes are dropped before changing the columns and added after, as they may depend on them.
+func (e mysqlEngine) alterTableStatements(changes *tableChanges) []string {
+	alter := "ALTER TABLE " + e.quote(changes.table) + " "
+	var statements []string
+
+	for _, fk := range changes.dropForeignKeys {
+		statements = append(statements, alter+"DROP FOREIGN KEY "+e.quote(fk.name))
+	}
+	for _, check := range changes.dropChecks {
+		statements = append(statements, alter+"DROP CHECK "+e.quote(check.name))
+	}
+	for _, index := range changes.dropIndexes {
+		statements = append(statements, alter+"DROP INDEX "+e.quote(index.name))
+	}
+	if changes.primaryKey && len(changes.current.primaryKey) > 0 {
+		statements = append(statements, alter+"DROP PRIMARY KEY")
+	}
+	for _, column := range changes.dropColumns {
+		statements = append(statements, alter+"DROP COLUMN "+e.quote(column))
+	}
+
+	for _, c := range changes.columns {
+		action := "MODIFY COLUMN "
+		if c.current == nil {
+			action = "ADD COLUMN "
+		}
+		position := " FIRST"
+		if c.after != "" {
+			position = " AFTER " + e.quote(c.after)
+		}
+		statements = append(statements, alter+action+e.columnDefinition(c.target)+position)
+	}
+
+	if changes.primaryKey && len(changes.target.primaryKey) > 0 {
+		columns := make([]string, 0, len(changes.target.primaryKey))
+		for _, c := range changes.target.primaryKey {
+			columns = append(columns, e.quote(c))
+		}
+		statements = append(statements, alter+"ADD PRIMARY KEY ("+strings.Join(columns, ",")+")")
+	}
+	for _, index := range changes.addIndexes {
+		// The name of the index goes after its kind, e.g. UNIQUE KEY `name` (`column`)
+		kind := index.definition[:strings.Index(index.definition, "KEY")+len("KEY")]
+		statements = append(statements, alter+"ADD "+kind+" "+e.quote(index.name)+index.definition[len(kind):])
+	}
+	for _, check := range changes.addChecks {
+		statements = append(statements, alter+"ADD CONSTRAINT "+e.quote(check.name)+" "+check.definition)
+	}
+	for _, fk := range changes.addForeignKeys {
+		statements = append(statements, alter+"ADD CONSTRAINT "+e.quote(fk.name)+" "+fk.definition)
+	}
+
+	for _, option := range changes.setOptions {
+		if option.name == "PARTITION" {
+			statements = append(statements, alter+option.definition)
+			continue
+		}
+		statements = append(statements, alter+option.name+"="+option.definition)
+	}
+	for _, option := range changes.resetOptions {
+		if option.name == "PARTITION" {
+			statements = append(statements, alter+"REMOVE PARTITIONING")
+			continue
+		}
+		statements = append(statements, fmt.Sprintf("-- option %s of table %s must be removed manually", option.name, changes.table))
+	}
+
+	return statements
+}
+
+// columnDefinition returns the definition of given column, as in SHOW CREATE TABLE.
+func (e mysqlEngine) columnDefinition(c schemaColumn) string {
+	definition := []string{e.quote(c.name), c.dataType}
+	if c.charset != "" {
+		definition = append(definition, "CHARACTER SET", c.charset)
+	}
+	if c.collation != "" {
+		definition = append(definition, "COLLATE", c.collation)
+	}
+	if c.nullable {
+		definition = append(definition, "NULL")
+	} else {
+		definition = append(definition, "NOT NULL")
+	}
+	if c.defaultValue != "" {
+		definition = append(definition, "DEFAULT", c.defaultValue)
+	}
+	if c.extra != "" {
+		definition = append(definition, c.extra)
+	}
+	return strings.Join(definition, " ")
+}
+
+func (e mysqlEngine) selectExpression(column tableColumn) string {
+	return e.quote(column.Name)
+}
+
+func (e mysqlEngine) orderExpression(column tableColumn) string {
+	if numericTypes[column.DataType] {
+		return e.quote(column.Name)
+	}
+	return fmt.Sprintf("CAST(%s AS BINARY)", e.quote(column.Name))
+}
+
+// checksumExpression returns the sum of the CRC32 of every row, so duplicated rows don't cancel each other out.
+// Each value is preceded by its length, so separators within values can't make different rows collide. Null
+// values are skipped by CONCAT_WS, so whether each column is null is also part of the checksum.
+func (e mysqlEngine) checksumExpression(columns []tableColumn) string {
+	values := make([]string, 0, 2*len(columns)+1)
+	nulls := make([]string, 0, len(columns))
+	for _, c := range columns {
+		values = append(values, fmt.Sprintf("LENGTH(%s)", e.quote(c.Name)), e.quote(c.Name))
+		nulls = append(nulls, fmt.Sprintf("ISNULL(%s)", e.quote(c.Name)))
+	}
+	values = append(values, fmt.Sprintf("CONCAT(%s)", strings.Join(nulls, ", ")))
+
+	return fmt.Sprintf("COALESCE(SUM(CRC32(CONCAT_WS('#', %s))), 0)", strings.Join(values, ", "))
+}
+
+// parseMySQLCreateTable parses the statement returned by SHOW CREATE TABLE, one line for each column,
+// key and constraint, followed by the table options and partitions:
+//
+//	CREATE TABLE `t` (
+//	  `id` int NOT NULL AUTO_INCREMENT,
+//	  PRIMARY KEY (`id`),
+//	  UNIQUE KEY `idx_email` (`email`)
+//	) ENGINE=InnoDB AUTO_INCREMENT=3 DEFAULT CHARSET=utf8mb4
+//
+// AUTO_INCREMENT is left out of the options, as it only depends on the rows inserted.
+func parseMySQLCreateTable(statement string) (*tableSchema, error) {
+	lines := strings.Split(statement, "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "CREATE TABLE ") {
+		return nil, fmt.Errorf("unexpected table definition: %s", lines[0])
+	}
+
+	schema := &tableSchema{primaryKeyName: "PRIMARY", create: autoIncrementOption.ReplaceAllString(statement, "")}
+	var partitions []string
+	optionsFound := false
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+
+		// Partitions are the only thing that follows the table options
+		if optionsFound {
+			partitions = append(partitions, line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "`"):
+			name, rest := parseMySQLIdentifier(line)
+			schema.columns = append(schema.columns, parseMySQLColumn(name, rest))
+		case strings.HasPrefix(line, "PRIMARY KEY "):
+			columns := strings.TrimSpace(strings.TrimPrefix(line, "PRIMARY KEY "))
+			for _, c := range strings.Split(columns[1:strings.IndexByte(columns, ')')], ",") {
+				name, _ := parseMySQLIdentifier(c)
+				schema.primaryKey = append(schema.primaryKey, name)
+			}
+		case strings.HasPrefix(line, "CONSTRAINT "):
+			name, rest := parseMySQLIdentifier(strings.TrimPrefix(line, "CONSTRAINT "))
+			element := schemaElement{name: name, definition: strings.TrimSpace(rest)}
+			if strings.HasPrefix(element.definition, "FOREIGN KEY") {
+				schema.foreignKeys = append(schema.foreignKeys, element)
+			} else {
+				schema.checks = append(schema.checks, element)
+			}
+		case strings.Contains(line, "KEY `"):
+			kind := line[:strings.Index(line, "KEY `")+len("KEY")]
+			name, rest := parseMySQLIdentifier(line[len(kind)+1:])
+			schema.indexes = append(schema.indexes, schemaElement{name: name, definition: kind + rest})
+		case strings.HasPrefix(line, ")"):
+			optionsFound = true
+			for _, token := range splitDefinition(line[1:]) {
+				option := strings.SplitN(token, "=", 2)
+				if len(option) == 2 && option[0] != "AUTO_INCREMENT" {
+					schema.options = append(schema.options, schemaElement{name: option[0], definition: option[1]})
+				}
+			}
+		}
+	}
+	if len(partitions) > 0 {
+		schema.options = append(schema.options, schemaElement{name: "PARTITION", definition: strings.Join(partitions, " ")})
+	}
+
+	return schema, nil
+}
+
+// parseMySQLColumn parses the definition of a column from SHOW CREATE TABLE,
+// e.g. "varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL DEFAULT 'a'".
+func parseMySQLColumn(name, definition string) schemaColumn {
+	tokens := splitDefinition(definition)
+	column := schemaColumn{name: name, nullable: true}
+	if len(tokens) == 0 {
+		return column
+	}
+
+	column.dataType = tokens[0]
+	i := 1
+	for ; i < len(tokens) && (tokens[i] == "unsigned" || tokens[i] == "zerofill"); i++ {
+		column.dataType += " " + tokens[i]
+	}
+
+	var extra []string
+	for ; i < len(tokens); i++ {
+		switch {
+		case tokens[i] == "CHARACTER" && i+2 < len(tokens) && tokens[i+1] == "SET":
+			column.charset = tokens[i+2]
+			i += 2
+		case tokens[i] == "COLLATE" && i+1 < len(tokens):
+			column.collation = tokens[i+1]
+			i++
+		case tokens[i] == "NOT" && i+1 < len(tokens) && tokens[i+1] == "NULL":
+			column.nullable = false
+			i++
+		case tokens[i] == "NULL":
+			column.nullable = true
+		case tokens[i] == "DEFAULT" && i+1 < len(tokens):
+			column.defaultValue = tokens[i+1]
+			i++
+		default:
+			extra = append(extra, tokens[i])
+		}
+	}
+	column.extra = strings.Join(extra, " ")
+
+	return column
+}
+
+// parseMySQLIdentifier returns the identifier quoted with backticks at the beginning of s, and the rest of s.
+func parseMySQLIdentifier(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "`") {
+		return s, ""
+	}
+
+	var name strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] == '`' {
+			if i+1 < len(s) && s[i+1] == '`' {
+				name.WriteByte('`')
+				i++
+				continue
+			}
+			return name.String(), s[i+1:]
+		}
+		name.WriteByte(s[i])
+	}
+	return name.String(), ""
+}
@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ncsvExtension is the extension of the files holding the data of each table.
+	// ncsvSchemaExtension is the extension of the files holding the schema of each Ncsv file.
+	ncsvExtension       = ".Ncsv"
+	ncsvSchemaExtension = ".Nschema"
+
+	// ncsvNull is how null values are written in Ncsv files.
+	//
+	// Values starting with ncsvEscape are written with an extra ncsvEscape at the beginning,
+	// so a value can never be confused with a null value.
+	ncsvNull   = `\N`
+	ncsvEscape = `\`
+
+	// ncsvEscaped is written at the beginning of the values holding carriage returns, which csv
+	// readers drop when followed by a line feed. The rest of the value is written with every \
+	// and carriage return written as \\ and \r (see ncsvEscaper).
+	ncsvEscaped = `\E`
+)
+
+var (
+	ncsvEscaper   = strings.NewReplacer(`\`, `\\`, "\r", `\r`)
+	ncsvUnescaper = strings.NewReplacer(`\\`, `\`, `\r`, "\r")
+)
+
+// ncsvSchema holds the columns of an Ncsv file, the key its rows are ordered by and the condition
+// its rows matched. It's written next to each Ncsv file, in a file with ncsvSchemaExtension.
+type ncsvSchema struct {
+	Columns []tableColumn `json:"columns"`
+	Key     []string      `json:"key"`
+	Filter  string        `json:"filter,omitempty"`
+}
+
+// ncsvPath returns the path of the Ncsv file of given table inside dir.
+func ncsvPath(dir, table string) string {
+	return filepath.Join(dir, table+ncsvExtension)
+}
+
+// ncsvSchemaPath returns the path of the schema file of given table inside dir.
+func ncsvSchemaPath(dir, table string) string {
+	return filepath.Join(dir, table+ncsvSchemaExtension)
+}
+
+// writeNcsvSchema writes the schema of given table inside dir.
+func writeNcsvSchema(dir, table string, schema *ncsvSchema) error {
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ncsvSchemaPath(dir, table), data, 0644)
+}
+
+// readNcsvSchema returns the schema of given table inside dir.
+// Returns nil if there is no schema file, e.g. when the Ncsv file was created by an older version.
+func readNcsvSchema(dir, table string) (*ncsvSchema, error) {
+	data, err := os.ReadFile(ncsvSchemaPath(dir, table))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	schema := &ncsvSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("reading schema of table %s: %v", table, err)
+	}
+	return schema, nil
+}
+
+// ncsvWriter writes rows into an Ncsv file.
+//
+// Ncsv files are csv files (RFC 4180) whose first row holds the names of the columns.
+type ncsvWriter struct {
+	w   *bufio.Writer
+	csv *csv.Writer
+}
+
+// newNcsvWriter returns a writer that writes into w.
+func newNcsvWriter(w io.Writer) *ncsvWriter {
+	bw := bufio.NewWriter(w)
+	return &ncsvWriter{
+		w:   bw,
+		csv: csv.NewWriter(bw),
+	}
+}
+
+// writeHeader writes the names of the columns.
+func (w *ncsvWriter) writeHeader(columns []string) error {
+	return w.write(columns)
+}
+
+// writeRow writes a row, a nil value means the value is null.
+func (w *ncsvWriter) writeRow(row []*string) error {
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = encodeNcsvValue(value)
+	}
+	return w.write(record)
+}
+
+// flush writes any buffered data into the underlying writer.
+func (w *ncsvWriter) flush() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+func (w *ncsvWriter) write(record []string) error {
+	// A record with a single empty field would be written as an empty line, which csv readers skip
+	if len(record) == 1 && record[0] == "" {
+		w.csv.Flush()
+		_, err := w.w.WriteString("\"\"\n")
+		return err
+	}
+	return w.csv.Write(record)
+}
+
+// ncsvReader reads the rows of an Ncsv file. It implements rowSource.
+type ncsvReader struct {
+	csv     *csv.Reader
+	columns []string
+}
+
+// newNcsvReader returns a reader that reads from r, reading the names of the columns right away.
+func newNcsvReader(r io.Reader) (*ncsvReader, error) {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errNoColumns
+		}
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+
+	return &ncsvReader{
+		csv:     cr,
+		columns: append([]string(nil), header...),
+	}, nil
+}
+
+// next returns the next row, or nil if there are no more rows. A nil value means the value is null.
+func (r *ncsvReader) next() ([]*string, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	row := make([]*string, len(record))
+	for i, field := range record {
+		row[i] = decodeNcsvValue(field)
+	}
+	return row, nil
+}
+
+// encodeNcsvValue returns how given value is written in an Ncsv file.
+func encodeNcsvValue(value *string) string {
+	if value == nil {
+		return ncsvNull
+	}
+	if strings.Contains(*value, "\r") {
+		return ncsvEscaped + ncsvEscaper.Replace(*value)
+	}
+	if strings.HasPrefix(*value, ncsvEscape) {
+		return ncsvEscape + *value
+	}
+	return *value
+}
+
+// decodeNcsvValue returns the value written as given field in an Ncsv file.
+func decodeNcsvValue(field string) *string {
+	if field == ncsvNull {
+		return nil
+	}
+	if strings.HasPrefix(field, ncsvEscaped) {
+		value := ncsvUnescaper.Replace(field[len(ncsvEscaped):])
+		return &value
+	}
+	value := strings.TrimPrefix(field, ncsvEscape)
+	return &value
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNcsvRoundTrip(t *testing.T) {
+	values := []string{"a,b", "line1\nline2", "line1\r\nline2", "a\rb\\r", `say "hi"`, "nil", `\N`, `\\x`, `\Ex`, ""}
+
+	var buf bytes.Buffer
+	w := newNcsvWriter(&buf)
+	err := w.writeHeader([]string{"id", "value"})
+	assert.NoError(t, err, "error writing header: %v", err)
+	for i := range values {
+		id := string(rune('1' + i))
+		err := w.writeRow([]*string{&id, &values[i]})
+		assert.NoError(t, err, "error writing row: %v", err)
+	}
+	id := "9"
+	err = w.writeRow([]*string{&id, nil})
+	assert.NoError(t, err, "error writing row: %v", err)
+	assert.NoError(t, w.flush())
+
+	r, err := newNcsvReader(&buf)
+	assert.NoError(t, err, "error reading header: %v", err)
+	assert.EqualValues(t, []string{"id", "value"}, r.columns)
+
+	for i := range values {
+		row, err := r.next()
+		assert.NoError(t, err, "error reading row: %v", err)
+		if assert.Len(t, row, 2) && assert.NotNil(t, row[1]) {
+			assert.EqualValues(t, values[i], *row[1])
+		}
+	}
+
+	row, err := r.next()
+	assert.NoError(t, err, "error reading row: %v", err)
+	if assert.Len(t, row, 2) {
+		assert.Nil(t, row[1])
+	}
+
+	row, err = r.next()
+	assert.NoError(t, err, "error reading row: %v", err)
+	assert.Nil(t, row)
+}
+
+func TestNcsvSingleEmptyColumn(t *testing.T) {
+	var buf bytes.Buffer
+	w := newNcsvWriter(&buf)
+	empty := ""
+	assert.NoError(t, w.writeHeader([]string{"value"}))
+	assert.NoError(t, w.writeRow([]*string{&empty}))
+	assert.NoError(t, w.writeRow([]*string{nil}))
+	assert.NoError(t, w.flush())
+
+	r, err := newNcsvReader(&buf)
+	assert.NoError(t, err, "error reading header: %v", err)
+
+	row, err := r.next()
+	assert.NoError(t, err, "error reading row: %v", err)
+	if assert.Len(t, row, 1) && assert.NotNil(t, row[0]) {
+		assert.EqualValues(t, "", *row[0])
+	}
+
+	row, err = r.next()
+	assert.NoError(t, err, "error reading row: %v", err)
+	if assert.Len(t, row, 1) {
+		assert.Nil(t, row[0])
+	}
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+var (
+	// booleanTypes holds the data types whose values are rendered as true/false instead of 1/0.
+	booleanTypes = map[string]bool{
+		"boolean": true,
+		"bool":    true,
+	}
+	// timeTypes holds the data types whose values are dates and/or times.
+	timeTypes = map[string]bool{
+		"date":                        true,
+		"time":                        true,
+		"datetime":                    true,
+		"timestamp":                   true,
+		"time without time zone":      true,
+		"time with time zone":         true,
+		"timestamp without time zone": true,
+		"timestamp with time zone":    true,
+	}
+	// hexBinaryTypes holds the data types whose values are rendered as \x followed by their bytes in hex.
+	hexBinaryTypes = map[string]bool{
+		"bytea": true,
+	}
+	// offsetTimeLayouts holds the layouts of dates with time and offset (see timeLayouts). Times without
+	// date are left with their offset, as they can't be moved to a location without knowing the date.
+	offsetTimeLayouts = []string{
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05-07",
+	}
+)
+
+// normalizedRowSource returns the rows of src with every value normalized (see normalizeValue),
+// so that rows read from databases of different engines can be compared.
+type normalizedRowSource struct {
+	src     rowSource
+	columns []tableColumn
+	// location is the time zone dates and times with an offset are rendered in (see timeZoneLocation).
+	location *time.Location
+}
+
+func (s *normalizedRowSource) next() ([]*string, error) {
+	row, err := s.src.next()
+	if row == nil || err != nil {
+		return nil, err
+	}
+
+	for i, value := range row {
+		if value != nil {
+			normalized := normalizeValue(s.columns[i].DataType, *value, s.location)
+			row[i] = &normalized
+		}
+	}
+	return row, nil
+}
+
+// normalizeValue returns given value as rendered by every engine, according to its data type:
+//   - booleans as 1 or 0, as MySQL stores them in tinyint(1) columns
+//   - numbers without trailing zeros after the decimal point, so decimals of different scales are equal
+//   - dates and times with a space between date and time and without trailing zeros in fractional seconds.
+//     Dates with time and offset (e.g. of PostgreSQL timestamptz columns) are rendered in given location
+//     without offset, as MySQL renders TIMESTAMP values
+//   - binary values as their bytes instead of their hex encoding
+func normalizeValue(dataType string, value string, location *time.Location) string {
+	switch {
+	case booleanTypes[dataType]:
+		switch strings.ToLower(value) {
+		case "true", "t":
+			return "1"
+		case "false", "f":
+			return "0"
+		}
+	case numericTypes[dataType]:
+		if !strings.ContainsAny(value, "eE") {
+			return trimFractionZeros(value)
+		}
+	case timeTypes[dataType]:
+		if len(value) > 10 && value[10] == 'T' {
+			value = value[:10] + " " + value[11:]
+		}
+		for _, layout := range offsetTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t.In(location).Format("2006-01-02 15:04:05.999999999")
+			}
+		}
+		return trimFractionZeros(value)
+	case hexBinaryTypes[dataType]:
+		if strings.HasPrefix(value, `\x`) {
+			if decoded, err := hex.DecodeString(value[2:]); err == nil {
+				return string(decoded)
+			}
+		}
+	}
+	return value
+}
+
+// timeZoneLocation returns the location of given time zone, as configured in time_zone: an offset like
+// +02:00 or the name of a zone. Returns UTC if no time zone is given or it isn't known.
+func timeZoneLocation(zone string) *time.Location {
+	if t, err := time.Parse("-07:00", zone); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(zone, offset)
+	}
+	if location, err := time.LoadLocation(zone); err == nil {
+		return location
+	}
+	return time.UTC
+}
+
+// trimFractionZeros removes the trailing zeros of the first fractional part of given value
+// (e.g. 1.500 -> 1.5, 10:00:00.000000+02 -> 10:00:00+02), and the decimal point if nothing is left.
+func trimFractionZeros(value string) string {
+	point := strings.IndexByte(value, '.')
+	if point < 0 {
+		return value
+	}
+
+	end := point + 1
+	for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+		end++
+	}
+
+	fraction := strings.TrimRight(value[point+1:end], "0")
+	if fraction == "" {
+		return value[:point] + value[end:]
+	}
+	return value[:point+1] + fraction + value[end:]
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		dataType string
+		value    string
+		expected string
+	}{
+		{"boolean", "true", "1"},
+		{"boolean", "f", "0"},
+		{"tinyint", "1", "1"},
+		{"decimal", "10.50", "10.5"},
+		{"numeric", "10.00", "10"},
+		{"numeric", "-0.0100", "-0.01"},
+		{"double precision", "1e+20", "1e+20"},
+		{"datetime", "2023-01-01 10:00:00.500000", "2023-01-01 10:00:00.5"},
+		{"timestamp without time zone", "2023-01-01T10:00:00", "2023-01-01 10:00:00"},
+		{"timestamp with time zone", "2023-01-01 10:00:00.000+02", "2023-01-01 08:00:00"},
+		{"time with time zone", "10:00:00.000+02", "10:00:00+02"},
+		{"bytea", `\x48656c6c6f`, "Hello"},
+		{"blob", `\x48656c6c6f`, `\x48656c6c6f`},
+		{"varchar", "10.50", "10.50"},
+	}
+
+	for _, test := range tests {
+		assert.EqualValues(t, test.expected, normalizeValue(test.dataType, test.value, time.UTC), "%s %s", test.dataType, test.value)
+	}
+}
+
+func TestNormalizeValueTimeZone(t *testing.T) {
+	// PostgreSQL renders timestamptz values with their offset, MySQL renders TIMESTAMP values in the time zone
+	// of the session without it
+	tests := []struct {
+		zone     string
+		postgres string
+		mysql    string
+	}{
+		{"", "2023-01-01 12:00:00.5+02", "2023-01-01 10:00:00.500000"},
+		{"+00:00", "2023-01-01T10:00:00+00:00", "2023-01-01 10:00:00"},
+		{"+01:00", "2023-01-01 10:00:00+00", "2023-01-01 11:00:00"},
+		{"-03:30", "2023-06-30 23:00:00-03:30", "2023-06-30 23:00:00"},
+	}
+
+	for _, test := range tests {
+		location := timeZoneLocation(test.zone)
+		assert.EqualValues(t, normalizeValue("datetime", test.mysql, location),
+			normalizeValue("timestamp with time zone", test.postgres, location), "%s %s", test.zone, test.postgres)
+	}
+
+	assert.EqualValues(t, time.UTC, timeZoneLocation("unknown zone"))
+}
+
+func TestPairColumns(t *testing.T) {
+	columns1 := []tableColumn{{Name: "id", DataType: "int"}, {Name: "Name", DataType: "varchar"}}
+	columns2 := []tableColumn{{Name: "name", DataType: "text"}, {Name: "id", DataType: "integer"}}
+
+	_, ok := pairColumns(columns1, columns2, nil, false)
+	assert.False(t, ok)
+
+	paired, ok := pairColumns(columns1, columns2, nil, true)
+	assert.True(t, ok)
+	assert.EqualValues(t, []tableColumn{{Name: "id", DataType: "integer"}, {Name: "name", DataType: "text"}}, paired)
+
+	_, ok = pairColumns(columns1, columns2[:1], nil, true)
+	assert.False(t, ok)
+}
+
+func TestPairTables(t *testing.T) {
+	config := createTestConf(t, `
+table_mappings:
+  - table_name: clients
+    table_name2: customers
+`)
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	tests := []struct {
+		name     string
+		dataOnly bool
+		tables1  []string
+		tables2  []string
+		pairs    []string // table1:table2
+		only1    []string
+		only2    []string
+	}{
+		{name: "same tables", tables1: []string{"a", "b"}, tables2: []string{"a", "b"}, pairs: []string{"a:a", "b:b"}},
+		{name: "missing tables don't shift the rest", tables1: []string{"a", "b", "c", "d"}, tables2: []string{"a", "aa", "b", "c"},
+			pairs: []string{"a:a", "b:b", "c:c"}, only1: []string{"d"}, only2: []string{"aa"}},
+		{name: "mapped table", tables1: []string{"clients", "customers"}, tables2: []string{"customers"},
+			pairs: []string{"clients:customers"}, only1: []string{"customers"}},
+		{name: "case sensitive", tables1: []string{"Users"}, tables2: []string{"users"},
+			only1: []string{"Users"}, only2: []string{"users"}},
+		{name: "case insensitive in data only mode", dataOnly: true, tables1: []string{"Users", "tags"}, tables2: []string{"users", "Tags", "tags"},
+			pairs: []string{"Users:users", "tags:tags"}, only2: []string{"Tags"}},
+	}
+
+	for _, test := range tests {
+		config.DataOnly = test.dataOnly
+		db1 := &databaseConn{engine: sqliteEngine{}}
+		for _, name := range test.tables1 {
+			db1.tables = append(db1.tables, fullTable{Name: name, Type: tableTypeBaseTable})
+		}
+		db2 := &databaseConn{engine: sqliteEngine{}}
+		for _, name := range test.tables2 {
+			db2.tables = append(db2.tables, fullTable{Name: name, Type: tableTypeBaseTable})
+		}
+
+		pairs, only1, only2 := pairTables(ctx, db1, db2)
+		pairNames := []string{}
+		for _, p := range pairs {
+			pairNames = append(pairNames, p.table1.Name+":"+p.table2.Name)
+		}
+		assert.EqualValues(t, append([]string{}, test.pairs...), pairNames, test.name)
+		assert.EqualValues(t, append([]string{}, test.only1...), tableNames(only1), test.name)
+		assert.EqualValues(t, append([]string{}, test.only2...), tableNames(only2), test.name)
+	}
+}
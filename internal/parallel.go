@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+	"sync"
+)
+
+// forEachTable calls fn with the index of every table from 0 to n-1 and returns the first error found.
+//
+// With parallelism 1 (the default), fn is called in order with dbs. Otherwise up to parallelism calls run at
+// once, each worker calling fn with its own copies of dbs (see databaseConn.worker), so fn must only change
+// what belongs to the table it was called with. Once a call fails, the remaining tables are not handled.
+func forEachTable(ctx context.Context, n int, dbs []*databaseConn, fn func(ctx context.Context, dbs []*databaseConn, i int) error) error {
+	parallelism := getConfigFromContext(ctx).GetParallelism()
+	if parallelism > n {
+		parallelism = n
+	}
+	if parallelism <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(ctx, dbs, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Open the connections of every worker before starting, so a failure leaves nothing running
+	workers := make([][]*databaseConn, 0, parallelism)
+	release := func() error {
+		var err error
+		for _, w := range workers {
+			for j, db := range w {
+				if releaseErr := dbs[j].release(db); err == nil {
+					err = releaseErr
+				}
+			}
+		}
+		return err
+	}
+	for len(workers) < parallelism {
+		w := make([]*databaseConn, 0, len(dbs))
+		for _, db := range dbs {
+			workerDB, err := db.worker(ctx)
+			if err != nil {
+				workers = append(workers, w)
+				release()
+				return err
+			}
+			w = append(w, workerDB)
+		}
+		workers = append(workers, w)
+	}
+
+	indexes := make(chan int)
+	errs := make(chan error, len(workers))
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w []*databaseConn) {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(ctx, w, i); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}(w)
+	}
+
+	// Hand out the tables in order until every one is handled or a worker fails
+send:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+
+	releaseErr := release()
+	if err, ok := <-errs; ok {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return releaseErr
+}
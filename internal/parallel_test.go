@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"go-db-compare/configs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareDatabasesParallel(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.Parallelism = 3
+
+	// Every table differs in one row, and t3 also in its schema
+	var statements1, statements2 []string
+	for i := 1; i <= 5; i++ {
+		statements1 = append(statements1,
+			fmt.Sprintf("CREATE TABLE t%d (id INTEGER PRIMARY KEY, name TEXT)", i),
+			fmt.Sprintf("INSERT INTO t%d VALUES (1, 'a'), (2, 'b')", i))
+		statements2 = append(statements2,
+			fmt.Sprintf("CREATE TABLE t%d (id INTEGER PRIMARY KEY, name TEXT)", i),
+			fmt.Sprintf("INSERT INTO t%d VALUES (1, 'a'), (2, 'x')", i))
+	}
+	statements2 = append(statements2, "CREATE INDEX t3_name ON t3 (name)")
+	config.Database1 = createTestSQLite(t, statements1...)
+	config.Database2 = createTestSQLite(t, statements2...)
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	db1, err := openDatabaseConnection(ctx, config.Database1)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db1.connection.Close()
+	db2, err := openDatabaseConnection(ctx, config.Database2)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db2.connection.Close()
+
+	changes := &syncChanges{}
+	db2.patch = &dataPatch{engine: db2.engine, out: changes}
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	// Tables and statements are in table order, whatever the order the workers finished in
+	assert.Len(t, result.Tables, 5)
+	for i, table := range result.Tables {
+		assert.EqualValues(t, fmt.Sprintf("t%d", i+1), table.Table)
+		assert.EqualValues(t, 2, table.Rows1)
+		assert.EqualValues(t, 1, table.Changed)
+		assert.EqualValues(t, fmt.Sprintf(`UPDATE "t%d" SET "name" = 'b' WHERE "id" = '2'`, i+1), changes.statements[i])
+	}
+	assert.Len(t, result.Tables[2].Schema, 1)
+	assert.Contains(t, db1.schemas, "t5")
+}
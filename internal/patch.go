@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// dataPatch builds the statements turning the data of database2 into the data of database1,
+// in the dialect of database2, and passes them to out.
+type dataPatch struct {
+	engine engine
+	out    patchWriter
+}
+
+// patchWriter receives the statements built by a dataPatch.
+type patchWriter interface {
+	// statement receives a statement, without the trailing semicolon.
+	statement(statement string) error
+	// comment receives a change that can't be made by a statement.
+	comment(text string) error
+}
+
+// patchFile writes the statements of a dataPatch to a file. It implements patchWriter.
+type patchFile struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+// patchBuffer keeps the statements of a dataPatch in memory, so they can be written later in order
+// (see compareData). It implements patchWriter.
+type patchBuffer struct {
+	entries []patchEntry
+}
+
+// patchEntry holds a statement or a comment kept by a patchBuffer.
+type patchEntry struct {
+	text    string
+	comment bool
+}
+
+// tablePatch writes the statements fixing the rows of a table (see dataPatch). It implements rowSink.
+type tablePatch struct {
+	patch *dataPatch
+	// table holds the table as named in database2.
+	table  tableData
+	keyIdx []int
+	// unkeyed is true if the rows can't be identified, as the table has no key.
+	unkeyed bool
+	// reported is true if the rows of an unkeyed table were reported as not fixed.
+	reported bool
+}
+
+// newPatchFile creates the file at path where the statements are written. The file must be closed with close.
+func newPatchFile(path string, label1, label2 string) (*patchFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &patchFile{file: file, w: bufio.NewWriter(file)}
+	if err := f.comment(fmt.Sprintf("Statements turning the data of %s into the data of %s", label2, label1)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// close writes the pending statements and closes the file.
+func (f *patchFile) close() error {
+	if err := f.w.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// statement writes given statement.
+func (f *patchFile) statement(statement string) error {
+	_, err := fmt.Fprintf(f.w, "%s;\n", statement)
+	return err
+}
+
+// comment writes given text as a comment.
+func (f *patchFile) comment(text string) error {
+	_, err := fmt.Fprintf(f.w, "-- %s\n", text)
+	return err
+}
+
+// statement keeps given statement.
+func (b *patchBuffer) statement(statement string) error {
+	b.entries = append(b.entries, patchEntry{text: statement})
+	return nil
+}
+
+// comment keeps given text as a comment.
+func (b *patchBuffer) comment(text string) error {
+	b.entries = append(b.entries, patchEntry{text: text, comment: true})
+	return nil
+}
+
+// writeTo passes the statements and comments kept to out, in the order they were received.
+func (b *patchBuffer) writeTo(out patchWriter) error {
+	for _, e := range b.entries {
+		var err error
+		if e.comment {
+			err = out.comment(e.text)
+		} else {
+			err = out.statement(e.text)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// table returns the sink writing the statements that fix the rows of given table of database2.
+func (p *dataPatch) table(t tableData) *tablePatch {
+	return &tablePatch{patch: p, table: t, keyIdx: columnIndexes(columnNames(t.columns), t.key), unkeyed: len(t.key) == 0}
+}
+
+// addRow writes an INSERT for rows only in database1, a DELETE for rows only in database2 and an
+// UPDATE of the columns that differ for rows in both.
+//
+// Rows are identified by the key of the table, so the rows of tables without key can't be fixed:
+// a comment is written instead, only once.
+func (t *tablePatch) addRow(row1, row2 []*string, changed []int) error {
+	e := t.patch.engine
+	switch {
+	case t.unkeyed:
+		if t.reported {
+			return nil
+		}
+		t.reported = true
+		return t.patch.out.comment(fmt.Sprintf("table %s has no key, its rows must be fixed manually", t.table.name))
+	case row2 == nil:
+		columns := make([]string, 0, len(t.table.columns))
+		values := make([]string, 0, len(row1))
+		for i, c := range t.table.columns {
+			columns = append(columns, e.quote(c.Name))
+			values = append(values, t.value(row1[i]))
+		}
+		return t.patch.out.statement(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			e.quote(t.table.name), strings.Join(columns, ", "), strings.Join(values, ", ")))
+	case row1 == nil:
+		return t.patch.out.statement(fmt.Sprintf("DELETE FROM %s WHERE %s", e.quote(t.table.name), t.where(row2)))
+	default:
+		set := make([]string, 0, len(changed))
+		for _, i := range changed {
+			set = append(set, e.quote(t.table.columns[i].Name)+" = "+t.value(row1[i]))
+		}
+		return t.patch.out.statement(fmt.Sprintf("UPDATE %s SET %s WHERE %s", e.quote(t.table.name), strings.Join(set, ", "), t.where(row2)))
+	}
+}
+
+// where returns the condition matching given row of database2 by key.
+func (t *tablePatch) where(row []*string) string {
+	conditions := make([]string, 0, len(t.keyIdx))
+	for _, i := range t.keyIdx {
+		column := t.patch.engine.quote(t.table.columns[i].Name)
+		if row[i] == nil {
+			conditions = append(conditions, column+" IS NULL")
+			continue
+		}
+		conditions = append(conditions, column+" = "+t.value(row[i]))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// value returns given value as a literal, NULL if the value is null.
+func (t *tablePatch) value(value *string) string {
+	if value == nil {
+		return "NULL"
+	}
+	return t.patch.engine.quoteValue(*value)
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"go-db-compare/configs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataPatchSQLite(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.ChunkSize = 2
+
+	for _, checksum := range []bool{false, true} {
+		config.Checksum = checksum
+		config.Database1 = createTestSQLite(t,
+			"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT, column1 TEXT)",
+			"CREATE TABLE logs (message TEXT)",
+			"INSERT INTO users VALUES (1, 'a', 'a@x', 'x'), (2, 'b''s', NULL, 'x'), (3, 'c', 'c@x', 'x'), (5, 'e', NULL, 'x')",
+			"INSERT INTO logs VALUES ('one'), ('two')")
+		config.Database2 = createTestSQLite(t,
+			"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT, column1 TEXT)",
+			"CREATE TABLE logs (message TEXT)",
+			"INSERT INTO users VALUES (1, 'a', 'a@x', 'y'), (2, 'b', 'b@x', 'y'), (4, 'd', NULL, 'y'), (5, 'e', NULL, 'y')",
+			"INSERT INTO logs VALUES ('one')")
+		ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+		db1, err := openDatabaseConnection(ctx, config.Database1)
+		assert.NoError(t, err, "error opening database: %v", err)
+		db2, err := openDatabaseConnection(ctx, config.Database2)
+		assert.NoError(t, err, "error opening database: %v", err)
+
+		path := filepath.Join(t.TempDir(), "datadiff.sql")
+		patch, err := newPatchFile(path, config.Database1.Label, config.Database2.Label)
+		assert.NoError(t, err, "error creating data patch: %v", err)
+		db2.patch = &dataPatch{engine: db2.engine, out: patch}
+		_, err = compareDatabases(ctx, db1, db2)
+		assert.NoError(t, err, "error comparing databases: %v", err)
+		err = patch.close()
+		assert.NoError(t, err, "error closing data patch: %v", err)
+		db1.tx.Rollback()
+		db2.tx.Rollback()
+
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err, "error reading data patch: %v", err)
+		assert.EqualValues(t, "-- Statements turning the data of "+config.Database2.Label+" into the data of "+config.Database1.Label+"\n"+
+			"-- table logs has no key, its rows must be fixed manually\n"+
+			"UPDATE \"users\" SET \"name\" = 'b''s', \"email\" = NULL WHERE \"id\" = '2';\n"+
+			"INSERT INTO \"users\" (\"id\", \"name\", \"email\") VALUES ('3', 'c', 'c@x');\n"+
+			"DELETE FROM \"users\" WHERE \"id\" = '4';\n", string(content))
+
+		// Once applied, only the table without key still differs
+		_, err = db2.connection.Exec(string(content))
+		assert.NoError(t, err, "error applying data patch: %v", err)
+		db2.patch = nil
+		result, err := compareDatabases(ctx, db1, db2)
+		assert.NoError(t, err, "error comparing databases: %v", err)
+		assert.EqualValues(t, 0, result.table("users").total())
+		assert.EqualValues(t, 1, result.table("logs").total())
+
+		db1.connection.Close()
+		db2.connection.Close()
+	}
+}
+
+func TestQuoteValueMySQL(t *testing.T) {
+	assert.EqualValues(t, `'it\'s a \\ \n\0'`, mysqlEngine{}.quoteValue("it's a \\ \n\x00"))
+}
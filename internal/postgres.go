@@ -0,0 +1,502 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go-db-compare/configs"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	defaultPostgresSchema = "public"
+
+	// stmtPostgresGetAllTables leaves out foreign and temporary tables, only base tables and views are compared
+	stmtPostgresGetAllTables = `SELECT table_name, table_type
+	FROM information_schema.tables
+	WHERE table_schema = current_schema() AND table_type IN ('BASE TABLE', 'VIEW')
+	ORDER BY table_name;`
+	stmtPostgresGetTableColumns = `SELECT column_name, data_type
+	FROM information_schema.columns
+	WHERE table_name = '%s' AND table_schema = '%s'
+	ORDER BY ordinal_position;`
+	stmtPostgresGetTableKeys = `SELECT i.relname, a.attname, NOT a.attnotnull
+	FROM pg_index x
+	JOIN pg_class t ON t.oid = x.indrelid
+	JOIN pg_class i ON i.oid = x.indexrelid
+	JOIN pg_namespace n ON n.oid = t.relnamespace
+	JOIN LATERAL unnest(x.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+	JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+	WHERE t.relname = '%s' AND n.nspname = '%s' AND x.indisunique
+	ORDER BY x.indisprimary DESC, i.relname, k.ord;`
+	stmtPostgresGetTableColumnsDefinition = `SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull,
+	COALESCE(pg_get_expr(d.adbin, d.adrelid), ''),
+	CASE WHEN a.attcollation <> t.typcollation THEN co.collname ELSE '' END,
+	a.attidentity, a.attgenerated
+	FROM pg_attribute a
+	JOIN pg_type t ON t.oid = a.atttypid
+	LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+	LEFT JOIN pg_collation co ON co.oid = a.attcollation
+	WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+	ORDER BY a.attnum;`
+	stmtPostgresGetTableConstraints = `SELECT conname, contype, pg_get_constraintdef(oid)
+	FROM pg_constraint
+	WHERE conrelid = $1::regclass
+	ORDER BY conname;`
+	stmtPostgresGetTableIndexes = `SELECT i.relname, pg_get_indexdef(x.indexrelid)
+	FROM pg_index x
+	JOIN pg_class i ON i.oid = x.indexrelid
+	WHERE x.indrelid = $1::regclass AND NOT x.indisprimary
+	ORDER BY i.relname;`
+	stmtPostgresGetTableOptions = `SELECT COALESCE(array_to_string(reloptions, ','), ''), relpersistence
+	FROM pg_class
+	WHERE oid = $1::regclass;`
+	stmtPostgresGetViewDefinition = `SELECT pg_get_viewdef($1::regclass, true);`
+	stmtPostgresSetSnapshot       = "SET TRANSACTION SNAPSHOT %s"
+	stmtPostgresExportSnapshot    = "SELECT pg_export_snapshot();"
+	stmtPostgresSetTimeZone       = "SET LOCAL TIME ZONE %s"
+	// Standbys report the last WAL location replayed, as they don't write WAL
+	stmtPostgresGetSnapshotPosition = `SELECT CAST(CASE WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END AS TEXT),
+	CAST(txid_current_snapshot() AS TEXT);`
+)
+
+// postgresEngine is the engine for PostgreSQL databases.
+type postgresEngine struct{}
+
+func (postgresEngine) driverName() string {
+	return enginePostgres
+}
+
+func (postgresEngine) dataSourceName(dbConfig *configs.Database, writable bool) string {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(dbConfig.Username, dbConfig.Password),
+		Host:   fmt.Sprintf("%s:%s", dbConfig.Host, dbConfig.Port),
+		Path:   dbConfig.Database,
+	}
+
+	query := url.Values{}
+	query.Set("search_path", postgresSchema(dbConfig))
+	if dbConfig.SSLMode != "" {
+		query.Set("sslmode", dbConfig.SSLMode)
+	}
+	dsn.RawQuery = query.Encode()
+
+	return dsn.String()
+}
+
+func (postgresEngine) namespace(dbConfig *configs.Database) string {
+	return postgresSchema(dbConfig)
+}
+
+func (postgresEngine) quote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+func (postgresEngine) placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (postgresEngine) quoteValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (postgresEngine) stmtGetAllTables() string {
+	return stmtPostgresGetAllTables
+}
+
+func (postgresEngine) stmtGetTableColumns() string {
+	return stmtPostgresGetTableColumns
+}
+
+func (postgresEngine) stmtGetTableKeys() string {
+	return stmtPostgresGetTableKeys
+}
+
+// beginSnapshot begins a REPEATABLE READ transaction, which reads the snapshot taken by its first query.
+func (e postgresEngine) beginSnapshot(ctx context.Context, db *sql.DB, writable bool, snapshot string) (dbTx, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: !writable})
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot != "" {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(stmtPostgresSetSnapshot, e.quoteValue(snapshot))); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+// exportSnapshot exports the snapshot of given transaction, which can be read by other transactions as long
+// as given transaction is open.
+func (postgresEngine) exportSnapshot(ctx context.Context, tx dbTx) (string, error) {
+	var snapshot string
+	if err := tx.QueryRowContext(ctx, stmtPostgresExportSnapshot).Scan(&snapshot); err != nil {
+		return "", err
+	}
+	return snapshot, nil
+}
+
+// lockWrites returns a nil unlock, as PostgreSQL shares snapshots (see exportSnapshot).
+func (postgresEngine) lockWrites(ctx context.Context, db *sql.DB) (func() error, error) {
+	return nil, nil
+}
+
+// snapshotPosition returns the current WAL location and the snapshot itself (the transactions visible to it),
+// e.g. "lsn 0/16B3748, snapshot 10:20:10,14,15". The WAL location is read when called, the snapshot is exact.
+func (postgresEngine) snapshotPosition(ctx context.Context, tx dbTx) (string, error) {
+	var lsn, snapshot sql.NullString
+	if err := tx.QueryRowContext(ctx, stmtPostgresGetSnapshotPosition).Scan(&lsn, &snapshot); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("lsn %s, snapshot %s", lsn.String, snapshot.String), nil
+}
+
+// setTimeZone sets the time zone of the transaction, which timestamptz values are rendered in.
+func (e postgresEngine) setTimeZone(ctx context.Context, tx dbTx, zone string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(stmtPostgresSetTimeZone, e.quoteValue(zone)))
+	return err
+}
+
+// getTableSchema returns the definition of given table built from the catalog, as PostgreSQL has no
+// equivalent to SHOW CREATE TABLE. For views, the definition of the view is returned.
+//
+// Unique and exclusion constraints are compared through the indexes backing them.
+func (e postgresEngine) getTableSchema(ctx context.Context, tx dbTx, namespace string, table fullTable) (*tableSchema, error) {
+	relation := e.quote(namespace) + "." + e.quote(table.Name)
+
+	if table.Type == tableTypeView {
+		var definition sql.NullString
+		if err := tx.QueryRowContext(ctx, stmtPostgresGetViewDefinition, relation).Scan(&definition); err != nil {
+			return nil, err
+		}
+		return &tableSchema{view: definition.String}, nil
+	}
+
+	schema := &tableSchema{}
+
+	// Columns
+	rows, err := tx.QueryContext(ctx, stmtPostgresGetTableColumnsDefinition, relation)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c schemaColumn
+		var identity, generated string
+		if err := rows.Scan(&c.name, &c.dataType, &c.nullable, &c.defaultValue, &c.collation, &identity, &generated); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		switch {
+		case identity == "a":
+			c.extra = "GENERATED ALWAYS AS IDENTITY"
+		case identity == "d":
+			c.extra = "GENERATED BY DEFAULT AS IDENTITY"
+		case generated == "s":
+			c.extra = fmt.Sprintf("GENERATED ALWAYS AS (%s) STORED", c.defaultValue)
+			c.defaultValue = ""
+		}
+		schema.columns = append(schema.columns, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Constraints
+	rows, err = tx.QueryContext(ctx, stmtPostgresGetTableConstraints, relation)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, constraintType, definition string
+		if err := rows.Scan(&name, &constraintType, &definition); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		switch constraintType {
+		case "p":
+			schema.primaryKeyName = name
+			columns := strings.TrimSuffix(strings.TrimPrefix(definition, "PRIMARY KEY ("), ")")
+			for _, c := range strings.Split(columns, ", ") {
+				schema.primaryKey = append(schema.primaryKey, strings.Trim(c, `"`))
+			}
+		case "f":
+			schema.foreignKeys = append(schema.foreignKeys, schemaElement{name: name, definition: definition})
+		case "c":
+			schema.checks = append(schema.checks, schemaElement{name: name, definition: definition})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Indexes, without the table they are created on, as the schema of each database may have a different name
+	rows, err = tx.QueryContext(ctx, stmtPostgresGetTableIndexes, relation)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		index := schemaElement{name: name, definition: definition}
+		if i := strings.Index(definition, " USING "); i >= 0 {
+			index.definition = definition[i+1:]
+			if strings.HasPrefix(definition, "CREATE UNIQUE INDEX ") {
+				index.definition = "UNIQUE " + index.definition
+			}
+		}
+		schema.indexes = append(schema.indexes, index)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Options
+	var options, persistence string
+	if err := tx.QueryRowContext(ctx, stmtPostgresGetTableOptions, relation).Scan(&options, &persistence); err != nil {
+		return nil, err
+	}
+	if options != "" {
+		for _, o := range strings.Split(options, ",") {
+			option := strings.SplitN(o, "=", 2)
+			if len(option) == 2 {
+				schema.options = append(schema.options, schemaElement{name: option[0], definition: option[1]})
+			}
+		}
+	}
+	if persistence == "u" {
+		schema.options = append(schema.options, schemaElement{name: "UNLOGGED", definition: "true"})
+	}
+
+	return schema, nil
+}
+
+func (e postgresEngine) createTableStatements(table string, schema *tableSchema) []string {
+	if schema.view != "" {
+		return []string{"CREATE VIEW " + e.quote(table) + " AS " + strings.TrimSuffix(strings.TrimSpace(schema.view), ";")}
+	}
+
+	definitions := make([]string, 0, len(schema.columns))
+	for _, c := range schema.columns {
+		definitions = append(definitions, e.columnDefinition(c))
+	}
+	if len(schema.primaryKey) > 0 {
+		definitions = append(definitions, e.primaryKeyDefinition(schema))
+	}
+	for _, check := range schema.checks {
+		definitions = append(definitions, "CONSTRAINT "+e.quote(check.name)+" "+check.definition)
+	}
+	for _, fk := range schema.foreignKeys {
+		definitions = append(definitions, "CONSTRAINT "+e.quote(fk.name)+" "+fk.definition)
+	}
+
+	create := "CREATE TABLE "
+	var options []string
+	for _, o := range schema.options {
+		if o.name == "UNLOGGED" {
+			create = "CREATE UNLOGGED TABLE "
+			continue
+		}
+		options = append(options, o.name+"="+o.definition)
+	}
+	statement := create + e.quote(table) + " (\n  " + strings.Join(definitions, ",\n  ") + "\n)"
+	if len(options) > 0 {
+		statement += " WITH (" + strings.Join(options, ", ") + ")"
+	}
+
+	statements := []string{statement}
+	for _, index := range schema.indexes {
+		statements = append(statements, e.createIndexStatement(table, index))
+	}
+	return statements
+}
+
+// alterTableStatements returns one statement for each change. Foreign keys, checks and indexes are
+// dropped before changing the columns and added after, as they may depend on them.
+// PostgreSQL can't change the position of a column, so moved columns are returned as comments.
+func (e postgresEngine) alterTableStatements(changes *tableChanges) []string {
+	alter := "ALTER TABLE " + e.quote(changes.table) + " "
+	var statements []string
+
+	for _, fk := range changes.dropForeignKeys {
+		statements = append(statements, alter+"DROP CONSTRAINT "+e.quote(fk.name))
+	}
+	for _, check := range changes.dropChecks {
+		statements = append(statements, alter+"DROP CONSTRAINT "+e.quote(check.name))
+	}
+	for _, index := range changes.dropIndexes {
+		statements = append(statements, "DROP INDEX "+e.quote(index.name))
+	}
+	if changes.primaryKey && len(changes.current.primaryKey) > 0 {
+		statements = append(statements, alter+"DROP CONSTRAINT "+e.quote(changes.current.primaryKeyName))
+	}
+	for _, column := range changes.dropColumns {
+		statements = append(statements, alter+"DROP COLUMN "+e.quote(column))
+	}
+
+	for _, c := range changes.columns {
+		column := alter + "ALTER COLUMN " + e.quote(c.target.name) + " "
+		switch {
+		case c.current == nil:
+			statements = append(statements, alter+"ADD COLUMN "+e.columnDefinition(c.target))
+			continue
+		case c.moved:
+			statements = append(statements, fmt.Sprintf("-- column %s of table %s can't be moved after %s",
+				c.target.name, changes.table, definitionOrNone(c.after)))
+		}
+
+		if c.target.dataType != c.current.dataType || c.target.collation != c.current.collation {
+			statement := column + "TYPE " + c.target.dataType
+			if c.target.collation != "" {
+				statement += " COLLATE " + e.quote(c.target.collation)
+			}
+			statements = append(statements, statement)
+		}
+		if c.target.nullable != c.current.nullable {
+			if c.target.nullable {
+				statements = append(statements, column+"DROP NOT NULL")
+			} else {
+				statements = append(statements, column+"SET NOT NULL")
+			}
+		}
+		if c.target.defaultValue != c.current.defaultValue {
+			if c.target.defaultValue == "" {
+				statements = append(statements, column+"DROP DEFAULT")
+			} else {
+				statements = append(statements, column+"SET DEFAULT "+c.target.defaultValue)
+			}
+		}
+		if c.target.extra != c.current.extra {
+			statements = append(statements, fmt.Sprintf("-- column %s of table %s must be changed manually: %s vs %s",
+				c.target.name, changes.table, definitionOrNone(c.target.extra), definitionOrNone(c.current.extra)))
+		}
+	}
+
+	if changes.primaryKey && len(changes.target.primaryKey) > 0 {
+		statements = append(statements, alter+"ADD "+e.primaryKeyDefinition(changes.target))
+	}
+	for _, index := range changes.addIndexes {
+		statements = append(statements, e.createIndexStatement(changes.table, index))
+	}
+	for _, check := range changes.addChecks {
+		statements = append(statements, alter+"ADD CONSTRAINT "+e.quote(check.name)+" "+check.definition)
+	}
+	for _, fk := range changes.addForeignKeys {
+		statements = append(statements, alter+"ADD CONSTRAINT "+e.quote(fk.name)+" "+fk.definition)
+	}
+
+	for _, option := range changes.setOptions {
+		if option.name == "UNLOGGED" {
+			statements = append(statements, alter+"SET UNLOGGED")
+			continue
+		}
+		statements = append(statements, alter+"SET ("+option.name+"="+option.definition+")")
+	}
+	for _, option := range changes.resetOptions {
+		if option.name == "UNLOGGED" {
+			statements = append(statements, alter+"SET LOGGED")
+			continue
+		}
+		statements = append(statements, alter+"RESET ("+option.name+")")
+	}
+
+	return statements
+}
+
+// columnDefinition returns the definition of given column, as in CREATE TABLE.
+func (e postgresEngine) columnDefinition(c schemaColumn) string {
+	definition := []string{e.quote(c.name), c.dataType}
+	if c.collation != "" {
+		definition = append(definition, "COLLATE", e.quote(c.collation))
+	}
+	if c.defaultValue != "" {
+		definition = append(definition, "DEFAULT", c.defaultValue)
+	}
+	if c.extra != "" {
+		definition = append(definition, c.extra)
+	}
+	if !c.nullable {
+		definition = append(definition, "NOT NULL")
+	}
+	return strings.Join(definition, " ")
+}
+
+// primaryKeyDefinition returns the definition of the primary key of given table, named as in schema.
+func (e postgresEngine) primaryKeyDefinition(schema *tableSchema) string {
+	columns := make([]string, 0, len(schema.primaryKey))
+	for _, c := range schema.primaryKey {
+		columns = append(columns, e.quote(c))
+	}
+	definition := "PRIMARY KEY (" + strings.Join(columns, ", ") + ")"
+	if schema.primaryKeyName != "" {
+		definition = "CONSTRAINT " + e.quote(schema.primaryKeyName) + " " + definition
+	}
+	return definition
+}
+
+// createIndexStatement returns the statement creating given index, whose definition is
+// "[UNIQUE ]USING method (columns)" (see getTableSchema).
+func (e postgresEngine) createIndexStatement(table string, index schemaElement) string {
+	create := "CREATE INDEX "
+	definition := index.definition
+	if strings.HasPrefix(definition, "UNIQUE ") {
+		create = "CREATE UNIQUE INDEX "
+		definition = strings.TrimPrefix(definition, "UNIQUE ")
+	}
+	return create + e.quote(index.name) + " ON " + e.quote(table) + " " + definition
+}
+
+// selectExpression casts every value to text, so values are returned as PostgreSQL renders them
+// instead of being converted by the driver (e.g. timestamps).
+func (e postgresEngine) selectExpression(column tableColumn) string {
+	return fmt.Sprintf("CAST(%s AS TEXT)", e.quote(column.Name))
+}
+
+// orderExpression orders non numeric columns by bytes through the C collation. Null values go first,
+// as in MySQL and SQLite, while PostgreSQL puts them last by default.
+func (e postgresEngine) orderExpression(column tableColumn) string {
+	if numericTypes[column.DataType] {
+		return e.quote(column.Name) + " NULLS FIRST"
+	}
+	return fmt.Sprintf(`CAST(%s AS TEXT) COLLATE "C" NULLS FIRST`, e.quote(column.Name))
+}
+
+// checksumExpression returns the sum of the first 32 bits of the MD5 of every row. Each value is preceded
+// by its length, so separators within values can't make different rows collide. Null values are skipped
+// by concat_ws, so whether each column is null is also part of the checksum.
+func (e postgresEngine) checksumExpression(columns []tableColumn) string {
+	values := make([]string, 0, 2*len(columns)+1)
+	nulls := make([]string, 0, len(columns))
+	for _, c := range columns {
+		values = append(values, fmt.Sprintf("length(%s)", e.selectExpression(c)), e.selectExpression(c))
+		nulls = append(nulls, fmt.Sprintf("CASE WHEN %s IS NULL THEN '1' ELSE '0' END", e.quote(c.Name)))
+	}
+	values = append(values, strings.Join(nulls, " || "))
+
+	return fmt.Sprintf("COALESCE(SUM(('x' || substr(md5(concat_ws('#', %s)), 1, 8))::bit(32)::bigint), 0)",
+		strings.Join(values, ", "))
+}
+
+// postgresSchema returns the schema holding the tables of given database.
+func postgresSchema(dbConfig *configs.Database) string {
+	if dbConfig.Schema == "" {
+		return defaultPostgresSchema
+	}
+	return dbConfig.Schema
+}
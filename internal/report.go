@@ -0,0 +1,342 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// List of available outputs
+	outputText       = "text"
+	outputJSON       = "json"
+	outputSchemaDiff = "schemadiff"
+	outputDataDiff   = "datadiff"
+)
+
+var (
+	// outputs is a map containing the valid outputs. Used for output validation.
+	outputs = map[string]bool{
+		outputText:       true,
+		outputJSON:       true,
+		outputSchemaDiff: true,
+		outputDataDiff:   true,
+	}
+)
+
+// rowDifferenceType tells how a row differs between both databases.
+type rowDifferenceType int
+
+const (
+	rowOnlyIn1 rowDifferenceType = iota
+	rowOnlyIn2
+	rowChanged
+)
+
+// rowDifferenceTypeNames holds the name of each rowDifferenceType, used in the json output.
+var rowDifferenceTypeNames = map[rowDifferenceType]string{
+	rowOnlyIn1: "only_in_database1",
+	rowOnlyIn2: "only_in_database2",
+	rowChanged: "changed",
+}
+
+// comparisonResult holds every difference found while comparing two databases.
+type comparisonResult struct {
+	Label1 string `json:"database1"`
+	Label2 string `json:"database2"`
+
+	// Position1 and Position2 hold the position in the log of each database (e.g. the binlog) of the
+	// snapshot that was read. Only recorded if configured with SnapshotPosition.
+	Position1 string `json:"snapshot_position_database1,omitempty"`
+	Position2 string `json:"snapshot_position_database2,omitempty"`
+
+	// TablesOnlyIn1 and TablesOnlyIn2 hold the tables that only exist in one of the databases.
+	TablesOnlyIn1 []string `json:"tables_only_in_database1"`
+	TablesOnlyIn2 []string `json:"tables_only_in_database2"`
+
+	// Problems holds the differences that are not related to a single table
+	// (e.g. paired tables of different types).
+	Problems []string            `json:"problems"`
+	Tables   []*tableDifferences `json:"tables"`
+
+	// mu guards Tables, as tables may be compared at once (see forEachTable).
+	mu sync.Mutex
+}
+
+// tableDifferences holds the differences found for a single table.
+type tableDifferences struct {
+	Table string `json:"table"`
+
+	// Schema holds every difference found between the schemas of the table. Empty if they match.
+	Schema []string `json:"schema,omitempty"`
+
+	// Key holds the columns used to match the rows of both databases.
+	// If empty, rows were matched using all of their columns.
+	Key []string `json:"key"`
+
+	// Filter holds the condition the compared rows had to match, empty if the rows were not filtered.
+	Filter string `json:"filter,omitempty"`
+
+	// Rows1 and Rows2 hold the number of rows of the table in each database.
+	Rows1 int `json:"rows_database1"`
+	Rows2 int `json:"rows_database2"`
+
+	// OnlyIn1, OnlyIn2 and Changed hold the number of rows found for each type of difference.
+	OnlyIn1 int `json:"rows_only_in_database1"`
+	OnlyIn2 int `json:"rows_only_in_database2"`
+	Changed int `json:"rows_changed"`
+
+	// Rows holds, at most, limit differences.
+	Rows []rowDifference `json:"differences"`
+}
+
+// rowDifference holds a row that is not the same in both databases.
+type rowDifference struct {
+	Type rowDifferenceType `json:"type"`
+
+	// Key identifies the row. If the table has no key, it holds every column of the row.
+	Key []keyValue `json:"key"`
+
+	// Values holds the columns that differ. Only used when Type is rowChanged.
+	Values []valueDifference `json:"values,omitempty"`
+}
+
+// keyValue holds the value of a key column. A nil value means the value is null.
+type keyValue struct {
+	Column string  `json:"column"`
+	Value  *string `json:"value"`
+}
+
+// valueDifference holds a value that is not the same in both databases. A nil value means the value is null.
+type valueDifference struct {
+	Column string  `json:"column"`
+	Value1 *string `json:"value_database1"`
+	Value2 *string `json:"value_database2"`
+}
+
+// newComparisonResult returns an empty result for the given database labels.
+func newComparisonResult(label1, label2 string) *comparisonResult {
+	return &comparisonResult{
+		Label1:        label1,
+		Label2:        label2,
+		TablesOnlyIn1: []string{},
+		TablesOnlyIn2: []string{},
+		Problems:      []string{},
+		Tables:        []*tableDifferences{},
+	}
+}
+
+// isValidOutput returns true if given output is valid.
+func isValidOutput(o string) bool {
+	return outputs[o]
+}
+
+// table returns the differences of given table, creating them if they don't exist yet.
+func (r *comparisonResult) table(name string) *tableDifferences {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.Tables {
+		if t.Table == name {
+			return t
+		}
+	}
+	t := &tableDifferences{Table: name}
+	r.Tables = append(r.Tables, t)
+	return t
+}
+
+// sortTables sorts the differences of each table in the order of given table names.
+// Tables not found in names are left at the end.
+func (r *comparisonResult) sortTables(names []string) {
+	position := make(map[string]int, len(names))
+	for i, name := range names {
+		position[name] = i
+	}
+
+	sort.SliceStable(r.Tables, func(i, j int) bool {
+		pi, ok := position[r.Tables[i].Table]
+		if !ok {
+			pi = len(names)
+		}
+		pj, ok := position[r.Tables[j].Table]
+		if !ok {
+			pj = len(names)
+		}
+		return pi < pj
+	})
+}
+
+// hasDifferences returns true if any difference was found.
+func (r *comparisonResult) hasDifferences() bool {
+	if len(r.Problems) > 0 || len(r.TablesOnlyIn1) > 0 || len(r.TablesOnlyIn2) > 0 {
+		return true
+	}
+	for _, t := range r.Tables {
+		if t.hasDifferences() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSchemaDifferences returns true if any difference other than the differences between rows was found.
+func (r *comparisonResult) hasSchemaDifferences() bool {
+	if len(r.Problems) > 0 || len(r.TablesOnlyIn1) > 0 || len(r.TablesOnlyIn2) > 0 {
+		return true
+	}
+	for _, t := range r.Tables {
+		if len(t.Schema) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDifferences returns true if any difference was found for this table.
+func (t *tableDifferences) hasDifferences() bool {
+	return len(t.Schema) > 0 || t.total() > 0
+}
+
+// total returns the total number of rows that differ.
+func (t *tableDifferences) total() int {
+	return t.OnlyIn1 + t.OnlyIn2 + t.Changed
+}
+
+// addRow registers a row difference, keeping only up to limit differences.
+func (t *tableDifferences) addRow(limit int, d rowDifference) {
+	switch d.Type {
+	case rowOnlyIn1:
+		t.OnlyIn1++
+	case rowOnlyIn2:
+		t.OnlyIn2++
+	case rowChanged:
+		t.Changed++
+	}
+	if len(t.Rows) < limit {
+		t.Rows = append(t.Rows, d)
+	}
+}
+
+// keyString returns the key of the row as a string, e.g. "id=1, name=a".
+func (d rowDifference) keyString() string {
+	var b strings.Builder
+	for i, k := range d.Key {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k.Column)
+		b.WriteString("=")
+		b.WriteString(valueToString(k.Value))
+	}
+	return b.String()
+}
+
+// MarshalJSON returns the name of the difference type.
+func (t rowDifferenceType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rowDifferenceTypeNames[t])
+}
+
+// write writes the result to w according to given output.
+//
+// When output is outputSchemaDiff or outputDataDiff, the result is written as text (the statements
+// themselves are written by writeSchemaMigration and dataPatch). Unless output is outputJSON,
+// detailed tells whether the differences of each table are shown (see print).
+func (r *comparisonResult) write(w io.Writer, output string, detailed bool) error {
+	switch output {
+	case outputJSON:
+		return r.printJSON(w)
+	default:
+		r.print(w, detailed)
+		return nil
+	}
+}
+
+// printJSON writes the result to w as json.
+func (r *comparisonResult) printJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// print writes a summary of the result to w.
+//
+// If detailed is false, only the tables that have differences are shown.
+// If detailed is true, the differences of each table are also shown.
+func (r *comparisonResult) print(w io.Writer, detailed bool) {
+	if r.Position1 != "" {
+		fmt.Fprintf(w, "%s read at %s\n", r.Label1, r.Position1)
+	}
+	if r.Position2 != "" {
+		fmt.Fprintf(w, "%s read at %s\n", r.Label2, r.Position2)
+	}
+
+	// The rows not matching the filters were not compared, so filters are shown even without differences
+	for _, t := range r.Tables {
+		if t.Filter != "" {
+			fmt.Fprintf(w, "table %s only compared rows where %s\n", t.Table, t.Filter)
+		}
+	}
+
+	if !r.hasDifferences() {
+		fmt.Fprintf(w, "no differences found between %s and %s\n", r.Label1, r.Label2)
+		return
+	}
+
+	for _, t := range r.TablesOnlyIn1 {
+		fmt.Fprintf(w, "table %s only exists in %s\n", t, r.Label1)
+	}
+	for _, t := range r.TablesOnlyIn2 {
+		fmt.Fprintf(w, "table %s only exists in %s\n", t, r.Label2)
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintln(w, p)
+	}
+
+	for _, t := range r.Tables {
+		if !t.hasDifferences() {
+			continue
+		}
+
+		fmt.Fprintf(w, "table %s has differences\n", t.Table)
+		if !detailed {
+			continue
+		}
+
+		for _, s := range t.Schema {
+			fmt.Fprintf(w, "\tschema: %s\n", s)
+		}
+		if t.total() == 0 {
+			continue
+		}
+
+		key := "all columns"
+		if len(t.Key) > 0 {
+			key = strings.Join(t.Key, ", ")
+		}
+		fmt.Fprintf(w, "\trows matched by %s. %s -> %d, %s -> %d\n", key, r.Label1, t.Rows1, r.Label2, t.Rows2)
+		fmt.Fprintf(w, "\trows only in %s: %d, rows only in %s: %d, rows changed: %d\n",
+			r.Label1, t.OnlyIn1, r.Label2, t.OnlyIn2, t.Changed)
+
+		for _, d := range t.Rows {
+			switch d.Type {
+			case rowOnlyIn1:
+				fmt.Fprintf(w, "\tonly in %s: %s\n", r.Label1, d.keyString())
+			case rowOnlyIn2:
+				fmt.Fprintf(w, "\tonly in %s: %s\n", r.Label2, d.keyString())
+			case rowChanged:
+				fmt.Fprintf(w, "\tchanged: %s\n", d.keyString())
+				for _, v := range d.Values {
+					fmt.Fprintf(w, "\t\tcolumn %s\n\t\t\t%s:\t'%s'\n\t\t\t%s:\t'%s'\n",
+						v.Column, r.Label1, valueToString(v.Value1), r.Label2, valueToString(v.Value2))
+				}
+			}
+		}
+		if t.total() > len(t.Rows) {
+			fmt.Fprintf(w, "\t... %d more differences\n", t.total()-len(t.Rows))
+		}
+	}
+}
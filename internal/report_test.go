@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJSON(t *testing.T) {
+	result := newComparisonResult("label1", "label2")
+	result.TablesOnlyIn2 = append(result.TablesOnlyIn2, "extra")
+	table := result.table("users")
+	table.Key = []string{"id"}
+	table.addRow(3, rowDifference{Type: rowChanged, Key: testKey("id", "1"),
+		Values: []valueDifference{{Column: "email", Value1: strPtr("a@b.c"), Value2: nil}}})
+
+	var buf bytes.Buffer
+	err := result.write(&buf, outputJSON, false)
+	assert.NoError(t, err, "error writing json: %v", err)
+
+	expected := `{
+		"database1": "label1",
+		"database2": "label2",
+		"tables_only_in_database1": [],
+		"tables_only_in_database2": ["extra"],
+		"problems": [],
+		"tables": [{
+			"table": "users",
+			"key": ["id"],
+			"rows_database1": 0,
+			"rows_database2": 0,
+			"rows_only_in_database1": 0,
+			"rows_only_in_database2": 0,
+			"rows_changed": 1,
+			"differences": [{
+				"type": "changed",
+				"key": [{"column": "id", "value": "1"}],
+				"values": [{"column": "email", "value_database1": "a@b.c", "value_database2": null}]
+			}]
+		}]
+	}`
+	assert.JSONEq(t, expected, buf.String())
+}
+
+func TestWriteTextFilter(t *testing.T) {
+	result := newComparisonResult("label1", "label2")
+	result.table("users").Filter = "tenant_id = 42"
+	result.table("tags")
+
+	var buf bytes.Buffer
+	err := result.write(&buf, outputText, true)
+	assert.NoError(t, err, "error writing text: %v", err)
+	assert.EqualValues(t, "table users only compared rows where tenant_id = 42\n"+
+		"no differences found between label1 and label2\n", buf.String())
+}
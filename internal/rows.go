@@ -0,0 +1,380 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"go-db-compare/configs"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// numericTypes holds the data types whose values are ordered as numbers.
+var numericTypes = map[string]bool{
+	"tinyint":   true,
+	"smallint":  true,
+	"mediumint": true,
+	"int":       true,
+	"integer":   true,
+	"bigint":    true,
+	"decimal":   true,
+	"numeric":   true,
+	"float":     true,
+	"double":    true,
+	"real":      true,
+	"year":      true,
+
+	// PostgreSQL
+	"double precision": true,
+}
+
+// tableColumn holds the name and data type of a table column.
+type tableColumn struct {
+	Name     string `json:"name"`
+	DataType string `json:"type"`
+}
+
+// rowSource is implemented by anything that returns the rows of a table, ordered by key.
+type rowSource interface {
+	// next returns the next row, or nil if there are no more rows.
+	// Each row holds one value for each column, a nil value means the value is null.
+	next() ([]*string, error)
+}
+
+// sqlRowSource returns the rows of a query, one at a time.
+type sqlRowSource struct {
+	rows    *sql.Rows
+	columns int
+}
+
+func (s *sqlRowSource) next() ([]*string, error) {
+	if !s.rows.Next() {
+		return nil, s.rows.Err()
+	}
+
+	strs := make([]*string, s.columns)
+	vals := make([]interface{}, s.columns)
+	for i := range vals {
+		vals[i] = &strs[i]
+	}
+	if err := s.rows.Scan(vals...); err != nil {
+		return nil, err
+	}
+	return strs, nil
+}
+
+// rowSink is implemented by anything that handles every row difference found by mergeRows, not only
+// the ones kept in the result (e.g. to write the statements fixing them).
+type rowSink interface {
+	// addRow receives the rows of a difference. row1 is nil if the row only exists in database2,
+	// row2 is nil if the row only exists in database1. If both rows are given, changed holds the
+	// indexes of the columns whose values are not the same (see rowLayout.changedColumns).
+	addRow(row1, row2 []*string, changed []int) error
+}
+
+// rowLayout holds the columns of the rows being compared and the key used to match them.
+type rowLayout struct {
+	columns []tableColumn
+	keyIdx  []int
+
+	// tolerances holds how much the values of each column can differ and still be considered
+	// the same, nil for the columns whose values must be exactly the same (see configure).
+	tolerances []*configs.Tolerance
+	// jsonPaths holds the paths left out of the documents of each JSON column (see configure).
+	jsonPaths [][]jsonPath
+}
+
+// newRowLayout returns the layout for given columns and key.
+// If the key is empty, rows are matched using all of their columns.
+func newRowLayout(columns []tableColumn, key []string) *rowLayout {
+	keyIdx := columnIndexes(columnNames(columns), key)
+	if len(keyIdx) == 0 {
+		keyIdx = make([]int, len(columns))
+		for i := range columns {
+			keyIdx[i] = i
+		}
+	}
+	return &rowLayout{
+		columns: columns,
+		keyIdx:  keyIdx,
+	}
+}
+
+// configure sets how the values of each column are compared, as configured for given table: how much
+// the values of the numeric and temporal columns can differ and still be considered the same (see
+// configs.Conf.GetTolerance), and the paths left out of the documents of the JSON columns (see
+// configs.Conf.GetIgnoredJSONPaths).
+func (l *rowLayout) configure(config *configs.Conf, table string) error {
+	l.tolerances = make([]*configs.Tolerance, len(l.columns))
+	l.jsonPaths = make([][]jsonPath, len(l.columns))
+	for i, c := range l.columns {
+		if jsonTypes[c.DataType] {
+			for _, p := range config.GetIgnoredJSONPaths(table, c.Name) {
+				path, err := parseJSONPath(p)
+				if err != nil {
+					return fmt.Errorf("%w: column %s of table %s: %v", ErrUsage, c.Name, table, err)
+				}
+				l.jsonPaths[i] = append(l.jsonPaths[i], path)
+			}
+			continue
+		}
+
+		tolerance := config.GetTolerance(table, c.Name)
+		switch {
+		case tolerance == nil:
+		case numericTypes[c.DataType] && (tolerance.Absolute > 0 || tolerance.Relative > 0),
+			timeTypes[c.DataType] && tolerance.Time > 0:
+			l.tolerances[i] = tolerance
+		}
+	}
+	return nil
+}
+
+// mergeRows matches the rows of both sources by key and registers the differences in t.
+//
+// Both sources must return their rows ordered by key (see makeQueryGetTableData), so that
+// only one row of each source needs to be kept in memory.
+// Rows whose key is only found in one of the sources are registered as rowOnlyIn1 or rowOnlyIn2,
+// rows whose key is found in both sources but have different values are registered as rowChanged.
+// If sink is not nil, it also receives the rows of every difference.
+func mergeRows(limit int, t *tableDifferences, layout *rowLayout, src1, src2 rowSource, sink rowSink) error {
+	row1, err := src1.next()
+	if err != nil {
+		return err
+	}
+	row2, err := src2.next()
+	if err != nil {
+		return err
+	}
+
+	for row1 != nil || row2 != nil {
+		var cmp int
+		switch {
+		case row1 == nil:
+			cmp = 1
+		case row2 == nil:
+			cmp = -1
+		default:
+			cmp = layout.compareKeys(row1, row2)
+		}
+
+		var diff1, diff2 []*string
+		var changed []int
+		switch {
+		case cmp < 0:
+			t.addRow(limit, rowDifference{Type: rowOnlyIn1, Key: layout.key(row1)})
+			diff1 = row1
+		case cmp > 0:
+			t.addRow(limit, rowDifference{Type: rowOnlyIn2, Key: layout.key(row2)})
+			diff2 = row2
+		default:
+			if changed = layout.changedColumns(row1, row2); len(changed) > 0 {
+				t.addRow(limit, rowDifference{Type: rowChanged, Key: layout.key(row1), Values: layout.values(row1, row2, changed)})
+				diff1, diff2 = row1, row2
+			}
+		}
+		if sink != nil && (diff1 != nil || diff2 != nil) {
+			if err := sink.addRow(diff1, diff2, changed); err != nil {
+				return err
+			}
+		}
+
+		// Advance the sources whose row was handled
+		if cmp <= 0 {
+			t.Rows1++
+			if row1, err = src1.next(); err != nil {
+				return err
+			}
+		}
+		if cmp >= 0 {
+			t.Rows2++
+			if row2, err = src2.next(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// compareKeys compares the keys of both rows, returning -1, 0 or 1 as in strings.Compare.
+//
+// Values are compared the same way the database orders them in makeQueryGetTableData:
+// numeric values as numbers, everything else by bytes. Null values come first.
+func (l *rowLayout) compareKeys(row1, row2 []*string) int {
+	for _, idx := range l.keyIdx {
+		if cmp := compareValues(row1[idx], row2[idx], numericTypes[l.columns[idx].DataType]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// values returns the values of the changed columns of both rows.
+func (l *rowLayout) values(row1, row2 []*string, changed []int) []valueDifference {
+	values := make([]valueDifference, 0, len(changed))
+	for _, i := range changed {
+		values = append(values, valueDifference{
+			Column: l.columns[i].Name,
+			Value1: row1[i],
+			Value2: row2[i],
+		})
+	}
+	return values
+}
+
+// changedColumns returns the indexes of the columns whose values are not the same in both rows.
+// JSON documents are compared as documents (see equalJSON), and values within the tolerance of their
+// column are considered the same (see withinTolerance).
+func (l *rowLayout) changedColumns(row1, row2 []*string) []int {
+	var idx []int
+	for i := range row1 {
+		if (row1[i] == nil) != (row2[i] == nil) || valueToString(row1[i]) != valueToString(row2[i]) {
+			if !l.equivalentValues(i, row1[i], row2[i]) {
+				idx = append(idx, i)
+			}
+		}
+	}
+	return idx
+}
+
+// equivalentValues returns whether both values of the column at given index, which are not exactly
+// the same, are still considered the same: as JSON documents for JSON columns, by the tolerance of
+// the column for the rest of columns.
+func (l *rowLayout) equivalentValues(idx int, value1, value2 *string) bool {
+	if value1 == nil || value2 == nil {
+		return false
+	}
+	if jsonTypes[l.columns[idx].DataType] {
+		var ignored []jsonPath
+		if l.jsonPaths != nil {
+			ignored = l.jsonPaths[idx]
+		}
+		return equalJSON(*value1, *value2, ignored)
+	}
+	return l.tolerances != nil && l.withinTolerance(idx, value1, value2)
+}
+
+// withinTolerance returns whether both values of the column at given index differ by at most the tolerance
+// of the column: as numbers for numeric columns, as instants for temporal columns. Returns false if the column
+// has no tolerance or any of the values is null or can't be parsed.
+func (l *rowLayout) withinTolerance(idx int, value1, value2 *string) bool {
+	tolerance := l.tolerances[idx]
+	if tolerance == nil || value1 == nil || value2 == nil {
+		return false
+	}
+
+	if timeTypes[l.columns[idx].DataType] {
+		t1, ok1 := parseTime(*value1)
+		t2, ok2 := parseTime(*value2)
+		if !ok1 || !ok2 {
+			return false
+		}
+		diff := t1.Sub(t2)
+		return diff >= -tolerance.Time && diff <= tolerance.Time
+	}
+
+	n1, err1 := strconv.ParseFloat(*value1, 64)
+	n2, err2 := strconv.ParseFloat(*value2, 64)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	diff := math.Abs(n1 - n2)
+	return diff <= tolerance.Absolute || diff <= tolerance.Relative*math.Max(math.Abs(n1), math.Abs(n2))
+}
+
+// timeLayouts holds the layouts dates and times are rendered with, with or without time zone offset.
+// Fractional seconds are accepted by every layout, and a T between date and time is replaced by parseTime.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"15:04:05Z07:00",
+	"15:04:05-07",
+	"15:04:05",
+}
+
+// parseTime returns the instant of given date and/or time, or false if it isn't rendered with any of
+// timeLayouts. Values without time zone offset are taken as UTC, so values rendered in different time
+// zones are only the same instant if both have their offset.
+func parseTime(value string) (time.Time, bool) {
+	if len(value) > 10 && value[10] == 'T' {
+		value = value[:10] + " " + value[11:]
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// key returns the key of given row.
+func (l *rowLayout) key(row []*string) []keyValue {
+	key := make([]keyValue, 0, len(l.keyIdx))
+	for _, idx := range l.keyIdx {
+		key = append(key, keyValue{
+			Column: l.columns[idx].Name,
+			Value:  row[idx],
+		})
+	}
+	return key
+}
+
+// compareValues compares two values, returning -1, 0 or 1 as in strings.Compare. Null values come first.
+// If numeric is true, values are compared as numbers.
+func compareValues(value1, value2 *string, numeric bool) int {
+	switch {
+	case value1 == nil && value2 == nil:
+		return 0
+	case value1 == nil:
+		return -1
+	case value2 == nil:
+		return 1
+	}
+
+	if numeric {
+		n1, ok1 := new(big.Rat).SetString(*value1)
+		n2, ok2 := new(big.Rat).SetString(*value2)
+		if ok1 && ok2 {
+			return n1.Cmp(n2)
+		}
+	}
+
+	return strings.Compare(*value1, *value2)
+}
+
+// columnIndexes returns the indexes in columns of the given key columns.
+// Key columns that are not present in columns are left out.
+func columnIndexes(columns, key []string) []int {
+	var idx []int
+	for _, k := range key {
+		for i, c := range columns {
+			if c == k {
+				idx = append(idx, i)
+				break
+			}
+		}
+	}
+	return idx
+}
+
+// columnNames returns the names of given columns.
+func columnNames(columns []tableColumn) []string {
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// valueToString returns the string representation of given value, "nil" if the value is null.
+func valueToString(value *string) string {
+	if value == nil {
+		return "nil"
+	}
+	return *value
+}
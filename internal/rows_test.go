@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"go-db-compare/configs"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithinToleranceNumeric(t *testing.T) {
+	tests := []struct {
+		tolerance configs.Tolerance
+		value1    *string
+		value2    *string
+		expected  bool
+	}{
+		{configs.Tolerance{Absolute: 0.01}, strPtr("1.5"), strPtr("1.505"), true},
+		{configs.Tolerance{Absolute: 0.01}, strPtr("1.505"), strPtr("1.5"), true},
+		{configs.Tolerance{Absolute: 0.01}, strPtr("-1.5"), strPtr("-1.52"), false},
+		{configs.Tolerance{Absolute: 0.01}, strPtr("1e3"), strPtr("1000.001"), true},
+		{configs.Tolerance{Relative: 0.01}, strPtr("1000"), strPtr("1009"), true},
+		{configs.Tolerance{Relative: 0.01}, strPtr("1"), strPtr("1.02"), false},
+		{configs.Tolerance{Relative: 0.01}, strPtr("-1000"), strPtr("-991"), true},
+		{configs.Tolerance{Absolute: 0.5, Relative: 0.01}, strPtr("1"), strPtr("1.4"), true},
+		{configs.Tolerance{Absolute: 0.5, Relative: 0.01}, strPtr("1000"), strPtr("1009"), true},
+		{configs.Tolerance{Absolute: 0.5, Relative: 0.01}, strPtr("10"), strPtr("11"), false},
+		{configs.Tolerance{Absolute: 1}, strPtr("NaN"), strPtr("NaN"), false},
+		{configs.Tolerance{Absolute: 1}, strPtr("1"), strPtr(strconv.FormatFloat(math.Inf(1), 'g', -1, 64)), false},
+		{configs.Tolerance{Absolute: 1}, strPtr("1"), strPtr("one"), false},
+		{configs.Tolerance{Absolute: 1}, strPtr("1"), strPtr("1e400"), false},
+		{configs.Tolerance{Absolute: 1}, strPtr("0"), nil, false},
+		{configs.Tolerance{Absolute: 1}, nil, nil, false},
+	}
+
+	layout := newRowLayout([]tableColumn{{Name: "value", DataType: "double"}}, nil)
+	for _, test := range tests {
+		tolerance := test.tolerance
+		layout.tolerances = []*configs.Tolerance{&tolerance}
+		assert.EqualValues(t, test.expected, layout.withinTolerance(0, test.value1, test.value2),
+			"%+v %s %s", test.tolerance, valueToString(test.value1), valueToString(test.value2))
+	}
+
+	// Columns without tolerance must be exactly the same
+	layout.tolerances = []*configs.Tolerance{nil}
+	assert.False(t, layout.withinTolerance(0, strPtr("1.0"), strPtr("1")))
+}
+
+func TestChangedColumns(t *testing.T) {
+	columns := []tableColumn{
+		{Name: "id", DataType: "int"},
+		{Name: "price", DataType: "decimal"},
+		{Name: "label", DataType: "varchar"},
+		{Name: "amount", DataType: "double"},
+	}
+	layout := newRowLayout(columns, []string{"id"})
+	row := func(values ...*string) []*string { return values }
+
+	// Without tolerances, values must be exactly the same
+	assert.Empty(t, layout.changedColumns(row(strPtr("1"), strPtr("1.5"), strPtr("a"), nil), row(strPtr("1"), strPtr("1.5"), strPtr("a"), nil)))
+	assert.EqualValues(t, []int{1, 3}, layout.changedColumns(
+		row(strPtr("1"), strPtr("1.50"), strPtr("a"), nil), row(strPtr("1"), strPtr("1.5"), strPtr("a"), strPtr("0"))))
+
+	// Tolerances only apply to numeric columns
+	config := createTestConf(t, `
+tolerance:
+  absolute: 0.1
+column_tolerances:
+  - table_name: products
+    column: amount
+    absolute: 0
+`)
+	assert.NoError(t, layout.configure(config, "products"))
+	assert.Empty(t, layout.changedColumns(row(strPtr("1"), strPtr("1.50"), strPtr("a"), nil), row(strPtr("1"), strPtr("1.55"), strPtr("a"), nil)))
+	assert.EqualValues(t, []int{1, 2, 3}, layout.changedColumns(
+		row(strPtr("1"), strPtr("1.5"), strPtr("0.1"), strPtr("1")), row(strPtr("1"), strPtr("1.7"), strPtr("0.15"), strPtr("1.01"))))
+	assert.EqualValues(t, []int{1}, layout.changedColumns(
+		row(strPtr("1"), nil, strPtr("a"), nil), row(strPtr("1"), strPtr("0"), strPtr("a"), nil)))
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string // RFC 3339 in UTC, empty if the value can't be parsed
+	}{
+		{"2023-01-01 10:00:00", "2023-01-01T10:00:00Z"},
+		{"2023-01-01T10:00:00", "2023-01-01T10:00:00Z"},
+		{"2023-01-01 10:00:00.250", "2023-01-01T10:00:00.25Z"},
+		{"2023-01-01 12:00:00+02", "2023-01-01T10:00:00Z"},
+		{"2023-01-01 12:00:00.5+02:00", "2023-01-01T10:00:00.5Z"},
+		{"2023-01-01T05:30:00-04:30", "2023-01-01T10:00:00Z"},
+		{"2023-01-01 10:00:00Z", "2023-01-01T10:00:00Z"},
+		{"2023-01-01", "2023-01-01T00:00:00Z"},
+		{"10:00:00", "0000-01-01T10:00:00Z"},
+		{"12:00:00+02", "0000-01-01T10:00:00Z"},
+		{"infinity", ""},
+		{"2023-13-01", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		parsed, ok := parseTime(test.value)
+		if test.expected == "" {
+			assert.False(t, ok, test.value)
+			continue
+		}
+		if assert.True(t, ok, test.value) {
+			assert.EqualValues(t, test.expected, parsed.UTC().Format(time.RFC3339Nano), test.value)
+		}
+	}
+}
+
+func TestWithinToleranceTime(t *testing.T) {
+	tests := []struct {
+		value1   string
+		value2   string
+		expected bool
+	}{
+		{"2023-01-01 10:00:00", "2023-01-01 10:00:02", true},
+		{"2023-01-01 10:00:02", "2023-01-01 10:00:00", true},
+		{"2023-01-01 10:00:00", "2023-01-01T10:00:01.999", true},
+		{"2023-01-01 10:00:00", "2023-01-01 10:00:02.001", false},
+		{"2023-01-01 09:59:57", "2023-01-01 10:00:00", false},
+		{"2023-01-01 12:00:01+02", "2023-01-01 10:00:00Z", true},
+		{"2023-01-01 12:00:00+02", "2023-01-01 12:00:00", false},
+		{"2023-01-01 10:00:00", "never", false},
+	}
+
+	layout := newRowLayout([]tableColumn{{Name: "created", DataType: "timestamp"}}, nil)
+	layout.tolerances = []*configs.Tolerance{{Time: 2 * time.Second}}
+	for _, test := range tests {
+		assert.EqualValues(t, test.expected, layout.withinTolerance(0, &test.value1, &test.value2), "%s %s", test.value1, test.value2)
+	}
+
+	// Numeric tolerances don't apply to dates and times
+	layout.tolerances = []*configs.Tolerance{{Absolute: 10}}
+	assert.False(t, layout.withinTolerance(0, strPtr("2023-01-01 10:00:00"), strPtr("2023-01-01 10:00:01")))
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tableSchema holds the definition of a table, as compared by compareSchema.
+type tableSchema struct {
+	columns    []schemaColumn
+	primaryKey []string
+
+	// indexes, foreignKeys, checks and options hold the elements of the table by name.
+	// The primary key is not part of indexes.
+	indexes     []schemaElement
+	foreignKeys []schemaElement
+	checks      []schemaElement
+	options     []schemaElement
+
+	// primaryKeyName holds the name of the primary key constraint, if the engine names it.
+	primaryKeyName string
+
+	// view holds the definition of the view, empty if the table is not a view.
+	view string
+	// create holds the statement creating the table, if the engine stores it.
+	create string
+}
+
+// schemaColumn holds the definition of a column. Attributes that don't apply are left empty.
+type schemaColumn struct {
+	name         string
+	dataType     string
+	nullable     bool
+	defaultValue string
+	charset      string
+	collation    string
+	// extra holds anything else defining the column (e.g. auto increment, generated columns, comments).
+	extra string
+}
+
+// schemaElement holds an element of a table identified by name and its definition
+// (e.g. an index and the columns it is made of).
+type schemaElement struct {
+	name       string
+	definition string
+}
+
+// attributes returns the attributes of the column, in the order they are compared.
+func (c schemaColumn) attributes() []schemaElement {
+	null := "NOT NULL"
+	if c.nullable {
+		null = "NULL"
+	}
+	return []schemaElement{
+		{"type", c.dataType},
+		{"null", null},
+		{"default", c.defaultValue},
+		{"charset", c.charset},
+		{"collation", c.collation},
+		{"extra", c.extra},
+	}
+}
+
+// renameColumns returns a copy of the schema whose columns, including the ones of the primary key,
+// are renamed by name. Elements defined by a statement (e.g. indexes) are left as they are.
+func (s *tableSchema) renameColumns(name func(column string) string) *tableSchema {
+	renamed := *s
+	renamed.columns = make([]schemaColumn, 0, len(s.columns))
+	for _, c := range s.columns {
+		c.name = name(c.name)
+		renamed.columns = append(renamed.columns, c)
+	}
+	renamed.primaryKey = make([]string, 0, len(s.primaryKey))
+	for _, c := range s.primaryKey {
+		renamed.primaryKey = append(renamed.primaryKey, name(c))
+	}
+	return &renamed
+}
+
+// diffTableSchemas returns every difference between both schemas, label1 and label2 naming the
+// database of each schema, e.g. "column `price` type decimal(10,2) vs decimal(12,2)" or
+// "index idx_email missing on label2".
+func diffTableSchemas(s1, s2 *tableSchema, label1, label2 string) []string {
+	if s1.view != "" || s2.view != "" {
+		if s1.view != s2.view {
+			return []string{"view definition doesn't match"}
+		}
+		return nil
+	}
+
+	var diffs []string
+
+	// Columns
+	columns2 := make(map[string]schemaColumn, len(s2.columns))
+	for _, c := range s2.columns {
+		columns2[c.name] = c
+	}
+	var common1 []string
+	for _, c1 := range s1.columns {
+		c2, ok := columns2[c1.name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("column `%s` missing on %s", c1.name, label2))
+			continue
+		}
+		common1 = append(common1, c1.name)
+
+		attributes2 := c2.attributes()
+		for i, a1 := range c1.attributes() {
+			if a1.definition != attributes2[i].definition {
+				diffs = append(diffs, fmt.Sprintf("column `%s` %s %s vs %s",
+					c1.name, a1.name, definitionOrNone(a1.definition), definitionOrNone(attributes2[i].definition)))
+			}
+		}
+	}
+
+	columns1 := make(map[string]bool, len(s1.columns))
+	for _, c := range s1.columns {
+		columns1[c.name] = true
+	}
+	var common2 []string
+	for _, c2 := range s2.columns {
+		if !columns1[c2.name] {
+			diffs = append(diffs, fmt.Sprintf("column `%s` missing on %s", c2.name, label1))
+			continue
+		}
+		common2 = append(common2, c2.name)
+	}
+
+	// Positions are compared among the columns existing in both tables, so a missing column isn't reported twice
+	for i, name := range common1 {
+		if common2[i] != name {
+			diffs = append(diffs, fmt.Sprintf("column `%s` position %d vs %d", name, i+1, indexOf(common2, name)+1))
+		}
+	}
+
+	// Primary key
+	pk1, pk2 := strings.Join(s1.primaryKey, ", "), strings.Join(s2.primaryKey, ", ")
+	switch {
+	case pk1 == pk2:
+	case pk1 == "":
+		diffs = append(diffs, fmt.Sprintf("primary key missing on %s", label1))
+	case pk2 == "":
+		diffs = append(diffs, fmt.Sprintf("primary key missing on %s", label2))
+	default:
+		diffs = append(diffs, fmt.Sprintf("primary key (%s) vs (%s)", pk1, pk2))
+	}
+
+	// Named elements
+	diffs = append(diffs, diffSchemaElements("index", s1.indexes, s2.indexes, label1, label2)...)
+	diffs = append(diffs, diffSchemaElements("foreign key", s1.foreignKeys, s2.foreignKeys, label1, label2)...)
+	diffs = append(diffs, diffSchemaElements("check", s1.checks, s2.checks, label1, label2)...)
+	diffs = append(diffs, diffSchemaElements("table option", s1.options, s2.options, label1, label2)...)
+
+	return diffs
+}
+
+// diffSchemaElements returns the differences between both lists of elements of given kind,
+// matching the elements by name.
+func diffSchemaElements(kind string, elements1, elements2 []schemaElement, label1, label2 string) []string {
+	var diffs []string
+
+	definitions2 := make(map[string]string, len(elements2))
+	for _, e := range elements2 {
+		definitions2[e.name] = e.definition
+	}
+	for _, e1 := range elements1 {
+		definition2, ok := definitions2[e1.name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("%s %s missing on %s", kind, e1.name, label2))
+		case e1.definition != definition2:
+			diffs = append(diffs, fmt.Sprintf("%s %s %s vs %s", kind, e1.name, e1.definition, definition2))
+		}
+	}
+
+	names1 := make(map[string]bool, len(elements1))
+	for _, e := range elements1 {
+		names1[e.name] = true
+	}
+	for _, e2 := range elements2 {
+		if !names1[e2.name] {
+			diffs = append(diffs, fmt.Sprintf("%s %s missing on %s", kind, e2.name, label1))
+		}
+	}
+
+	return diffs
+}
+
+// definitionOrNone returns given definition, or "none" if it is empty.
+func definitionOrNone(definition string) string {
+	if definition == "" {
+		return "none"
+	}
+	return definition
+}
+
+// indexOf returns the index of value in values, -1 if it is not found.
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitDefinition splits given definition into tokens separated by spaces. Strings quoted with
+// single quotes, double quotes or backticks and parentheses are kept in the token they appear in, e.g.
+// "DEFAULT 'a b' COMMENT (x + 1)" is split into "DEFAULT", "'a b'", "COMMENT" and "(x + 1)".
+func splitDefinition(definition string) []string {
+	var tokens []string
+	var current strings.Builder
+	var quote byte
+	depth := 0
+
+	for i := 0; i < len(definition); i++ {
+		ch := definition[i]
+		switch {
+		case quote != 0:
+			current.WriteByte(ch)
+			if ch == '\\' && quote != '`' && i+1 < len(definition) {
+				i++
+				current.WriteByte(definition[i])
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+			current.WriteByte(ch)
+		case ch == '(':
+			depth++
+			current.WriteByte(ch)
+		case ch == ')':
+			depth--
+			current.WriteByte(ch)
+		case (ch == ' ' || ch == '\t' || ch == '\n') && depth == 0:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens
+}
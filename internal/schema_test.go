@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMySQLCreateTable = "CREATE TABLE `products` (\n" +
+	"  `id` int unsigned NOT NULL AUTO_INCREMENT,\n" +
+	"  `name` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL DEFAULT 'a b',\n" +
+	"  `price` decimal(10,2) DEFAULT NULL COMMENT 'price, in euros',\n" +
+	"  `category_id` int DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  UNIQUE KEY `idx_name` (`name`),\n" +
+	"  KEY `idx_category` (`category_id`,`price`),\n" +
+	"  CONSTRAINT `fk_category` FOREIGN KEY (`category_id`) REFERENCES `categories` (`id`) ON DELETE CASCADE,\n" +
+	"  CONSTRAINT `chk_price` CHECK ((`price` > 0))\n" +
+	") ENGINE=InnoDB AUTO_INCREMENT=12 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='all products'"
+
+func TestParseMySQLCreateTable(t *testing.T) {
+	schema, err := parseMySQLCreateTable(testMySQLCreateTable)
+	assert.NoError(t, err, "error parsing table: %v", err)
+
+	assert.EqualValues(t, &tableSchema{
+		columns: []schemaColumn{
+			{name: "id", dataType: "int unsigned", extra: "AUTO_INCREMENT"},
+			{name: "name", dataType: "varchar(20)", defaultValue: "'a b'", charset: "utf8mb4", collation: "utf8mb4_bin"},
+			{name: "price", dataType: "decimal(10,2)", nullable: true, defaultValue: "NULL", extra: "COMMENT 'price, in euros'"},
+			{name: "category_id", dataType: "int", nullable: true, defaultValue: "NULL"},
+		},
+		primaryKey: []string{"id"},
+		indexes: []schemaElement{
+			{name: "idx_name", definition: "UNIQUE KEY (`name`)"},
+			{name: "idx_category", definition: "KEY (`category_id`,`price`)"},
+		},
+		foreignKeys: []schemaElement{
+			{name: "fk_category", definition: "FOREIGN KEY (`category_id`) REFERENCES `categories` (`id`) ON DELETE CASCADE"},
+		},
+		checks: []schemaElement{{name: "chk_price", definition: "CHECK ((`price` > 0))"}},
+		options: []schemaElement{
+			{name: "ENGINE", definition: "InnoDB"},
+			{name: "CHARSET", definition: "utf8mb4"},
+			{name: "COLLATE", definition: "utf8mb4_0900_ai_ci"},
+			{name: "COMMENT", definition: "'all products'"},
+		},
+		primaryKeyName: "PRIMARY",
+		create:         strings.Replace(testMySQLCreateTable, "AUTO_INCREMENT=12 ", "", 1),
+	}, schema)
+
+	_, err = parseMySQLCreateTable("CREATE VIEW `v` AS select 1")
+	assert.Error(t, err)
+}
+
+func TestParseMySQLCreateTableAutoIncrement(t *testing.T) {
+	tests := []struct {
+		options  string
+		expected []schemaElement
+		create   string
+	}{
+		{") ENGINE=InnoDB AUTO_INCREMENT=123 COMMENT='cd'",
+			[]schemaElement{{name: "ENGINE", definition: "InnoDB"}, {name: "COMMENT", definition: "'cd'"}},
+			") ENGINE=InnoDB COMMENT='cd'"},
+		// Only the option written by MySQL is left out
+		{") ENGINE=InnoDB Auto_increment=123",
+			[]schemaElement{{name: "ENGINE", definition: "InnoDB"}, {name: "Auto_increment", definition: "123"}},
+			") ENGINE=InnoDB Auto_increment=123"},
+		// Options are not taken as patterns
+		{") ENGINE=InnoDB COMMENT='=.*'",
+			[]schemaElement{{name: "ENGINE", definition: "InnoDB"}, {name: "COMMENT", definition: "'=.*'"}},
+			") ENGINE=InnoDB COMMENT='=.*'"},
+		{")", nil, ")"},
+	}
+
+	for _, test := range tests {
+		columns := "CREATE TABLE `t` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n"
+		schema, err := parseMySQLCreateTable(columns + test.options)
+		assert.NoError(t, err, "error parsing table: %v", err)
+		assert.EqualValues(t, test.expected, schema.options, test.options)
+		assert.EqualValues(t, columns+test.create, schema.create, test.options)
+		assert.EqualValues(t, "AUTO_INCREMENT", schema.columns[0].extra, test.options)
+	}
+
+	// Tables that only differ in their next auto increment value are the same
+	schema1, err := parseMySQLCreateTable(strings.Replace(testMySQLCreateTable, "AUTO_INCREMENT=12", "AUTO_INCREMENT=123", 1))
+	assert.NoError(t, err, "error parsing table: %v", err)
+	schema2, err := parseMySQLCreateTable(testMySQLCreateTable)
+	assert.NoError(t, err, "error parsing table: %v", err)
+	assert.Empty(t, diffTableSchemas(schema1, schema2, "label1", "label2"))
+
+	_, err = parseMySQLCreateTable("")
+	assert.Error(t, err)
+}
+
+func TestDiffTableSchemas(t *testing.T) {
+	schema1, err := parseMySQLCreateTable(testMySQLCreateTable)
+	assert.NoError(t, err, "error parsing table: %v", err)
+	schema2, err := parseMySQLCreateTable("CREATE TABLE `products` (\n" +
+		"  `id` int unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `price` decimal(12,2) DEFAULT NULL COMMENT 'price, in euros',\n" +
+		"  `name` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL DEFAULT 'a b',\n" +
+		"  `stock` int NOT NULL,\n" +
+		"  PRIMARY KEY (`id`,`name`),\n" +
+		"  UNIQUE KEY `idx_name` (`name`),\n" +
+		"  CONSTRAINT `chk_price` CHECK ((`price` >= 0))\n" +
+		") ENGINE=InnoDB AUTO_INCREMENT=3 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='all products'")
+	assert.NoError(t, err, "error parsing table: %v", err)
+
+	assert.Empty(t, diffTableSchemas(schema1, schema1, "label1", "label2"))
+	assert.EqualValues(t, []string{
+		"column `price` type decimal(10,2) vs decimal(12,2)",
+		"column `category_id` missing on label2",
+		"column `stock` missing on label1",
+		"column `name` position 2 vs 3",
+		"column `price` position 3 vs 2",
+		"primary key (id) vs (id, name)",
+		"index idx_category missing on label2",
+		"foreign key fk_category missing on label2",
+		"check chk_price CHECK ((`price` > 0)) vs CHECK ((`price` >= 0))",
+	}, diffTableSchemas(schema1, schema2, "label1", "label2"))
+
+	assert.EqualValues(t, []string{"view definition doesn't match"},
+		diffTableSchemas(&tableSchema{view: "select 1"}, &tableSchema{view: "select 2"}, "label1", "label2"))
+}
@@ -0,0 +1,471 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"net/url"
+	"strings"
+
+	"go-db-compare/configs"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// sqliteDriverName is the name of the driver registered with the functions used by the comparison (see init)
+	sqliteDriverName = "sqlite3_compare"
+	sqliteNamespace  = "main"
+	// sqliteAutoIndexPrefix is the prefix of the indexes created along with the table for unique constraints
+	sqliteAutoIndexPrefix = "sqlite_autoindex_"
+
+	stmtSQLiteGetAllTables = `SELECT name, CASE type WHEN 'table' THEN 'BASE TABLE' ELSE 'VIEW' END
+	FROM sqlite_master
+	WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+	ORDER BY name;`
+	// Declared types are lowercased and stripped of their arguments (e.g. VARCHAR(20) -> varchar), as MySQL's DATA_TYPE
+	stmtSQLiteGetTableColumns = `SELECT name, lower(trim(iif(instr(type, '(') > 0, substr(type, 1, instr(type, '(') - 1), type)))
+	FROM pragma_table_info('%[1]s', '%[2]s')
+	ORDER BY cid;`
+	// The primary key of a table is only listed by pragma_index_list when it isn't an alias of the rowid,
+	// so it is read from pragma_table_info instead
+	// stmtSQLiteGetTableKeys lists the columns of the primary key and unique indexes. Columns of the primary key
+	// may be null unless declared NOT NULL, except the one of an INTEGER PRIMARY KEY, which holds the rowid.
+	stmtSQLiteGetTableKeys = `SELECT index_name, column_name, nullable FROM (
+		SELECT 0 AS primary_last, 'PRIMARY' AS index_name, name AS column_name, pk AS seq,
+		"notnull" = 0 AND NOT (upper(type) = 'INTEGER' AND
+			(SELECT COUNT(*) FROM pragma_table_info('%[1]s', '%[2]s') WHERE pk > 0) = 1) AS nullable
+		FROM pragma_table_info('%[1]s', '%[2]s')
+		WHERE pk > 0
+		UNION ALL
+		SELECT 1, l.name, i.name, i.seqno,
+		COALESCE((SELECT c."notnull" = 0 FROM pragma_table_info('%[1]s', '%[2]s') AS c WHERE c.name = i.name), 1)
+		FROM pragma_index_list('%[1]s', '%[2]s') AS l, pragma_index_info(l.name, '%[2]s') AS i
+		WHERE l."unique" = 1 AND l.origin <> 'pk'
+	)
+	ORDER BY primary_last, index_name, seq;`
+	stmtSQLiteGetTableInformation = `SELECT sql
+	FROM %s.sqlite_master
+	WHERE type IN ('table', 'view') AND name = ?;`
+	stmtSQLiteGetTableColumnsDefinition = `SELECT name, type, NOT "notnull", COALESCE(dflt_value, ''), pk, hidden
+	FROM pragma_table_xinfo(?, ?)
+	WHERE hidden <> 1
+	ORDER BY cid;`
+	stmtSQLiteGetTableIndexes = `SELECT l.name, l."unique", l.partial, i.name
+	FROM pragma_index_list(?, ?) AS l, pragma_index_info(l.name, ?) AS i
+	WHERE l.origin <> 'pk'
+	ORDER BY l.name, i.seqno;`
+	stmtSQLiteGetTableForeignKeys = `SELECT id, "table", "from", "to", on_update, on_delete
+	FROM pragma_foreign_key_list(?, ?)
+	ORDER BY id, seq;`
+)
+
+func init() {
+	// SQLite has no checksum function, register crc32 so checksums are computed as in MySQL
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("crc32", func(s string) int64 {
+				return int64(crc32.ChecksumIEEE([]byte(s)))
+			}, true)
+		},
+	})
+}
+
+// sqliteEngine is the engine for SQLite databases.
+type sqliteEngine struct{}
+
+// sqliteForeignKey holds a foreign key as listed by pragma_foreign_key_list, one row for each column.
+type sqliteForeignKey struct {
+	table, onUpdate, onDelete string
+	from, to                  []string
+}
+
+func (sqliteEngine) driverName() string {
+	return sqliteDriverName
+}
+
+// dataSourceName opens the database file in read-write mode, so a missing file is reported
+// instead of an empty database being created. The path is escaped, as the name is a URI where
+// ? and # would start the options.
+func (sqliteEngine) dataSourceName(dbConfig *configs.Database, writable bool) string {
+	path := &url.URL{Path: dbConfig.Path}
+	return fmt.Sprintf("file:%s?mode=rw", path.EscapedPath())
+}
+
+func (sqliteEngine) namespace(dbConfig *configs.Database) string {
+	return sqliteNamespace
+}
+
+func (sqliteEngine) quote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+func (sqliteEngine) placeholder(n int) string {
+	return "?"
+}
+
+func (sqliteEngine) quoteValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (sqliteEngine) stmtGetAllTables() string {
+	return stmtSQLiteGetAllTables
+}
+
+func (sqliteEngine) stmtGetTableColumns() string {
+	return stmtSQLiteGetTableColumns
+}
+
+func (sqliteEngine) stmtGetTableKeys() string {
+	return stmtSQLiteGetTableKeys
+}
+
+// beginSnapshot begins a deferred transaction, which reads the snapshot taken by its first query.
+// SQLite transactions are always serializable, and the driver doesn't support read-only transactions.
+func (sqliteEngine) beginSnapshot(ctx context.Context, db *sql.DB, writable bool, snapshot string) (dbTx, error) {
+	return db.BeginTx(ctx, &sql.TxOptions{})
+}
+
+// exportSnapshot returns an empty id, as SQLite can't share snapshots between connections.
+func (sqliteEngine) exportSnapshot(ctx context.Context, tx dbTx) (string, error) {
+	return "", nil
+}
+
+// lockWrites returns a nil unlock, as SQLite has no lock outliving a transaction.
+func (sqliteEngine) lockWrites(ctx context.Context, db *sql.DB) (func() error, error) {
+	return nil, nil
+}
+
+// snapshotPosition returns an empty position, as SQLite has no log to point to.
+func (sqliteEngine) snapshotPosition(ctx context.Context, tx dbTx) (string, error) {
+	return "", nil
+}
+
+// setTimeZone does nothing, as SQLite stores dates and times as they are written.
+func (sqliteEngine) setTimeZone(ctx context.Context, tx dbTx, zone string) error {
+	return nil
+}
+
+// getTableSchema returns the definition of given table read from its pragmas. Checks and table options
+// are not available through pragmas, so they are read from the stored CREATE statement.
+// For views, the CREATE statement of the view is returned.
+func (e sqliteEngine) getTableSchema(ctx context.Context, tx dbTx, namespace string, table fullTable) (*tableSchema, error) {
+	var statement string
+	query := fmt.Sprintf(stmtSQLiteGetTableInformation, e.quote(namespace))
+	if err := tx.QueryRowContext(ctx, query, table.Name).Scan(&statement); err != nil {
+		return nil, err
+	}
+	if table.Type == tableTypeView {
+		return &tableSchema{view: statement}, nil
+	}
+
+	schema := &tableSchema{create: statement}
+	schema.checks, schema.options = parseSQLiteCreateTable(statement)
+
+	// Columns, and the primary key from their position in it
+	rows, err := tx.QueryContext(ctx, stmtSQLiteGetTableColumnsDefinition, table.Name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	primaryKey := make(map[int]string)
+	for rows.Next() {
+		var c schemaColumn
+		var pk, hidden int
+		if err := rows.Scan(&c.name, &c.dataType, &c.nullable, &c.defaultValue, &pk, &hidden); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		switch hidden {
+		case 2:
+			c.extra = "GENERATED ALWAYS VIRTUAL"
+		case 3:
+			c.extra = "GENERATED ALWAYS STORED"
+		}
+		if pk > 0 {
+			primaryKey[pk] = c.name
+		}
+		schema.columns = append(schema.columns, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := 1; i <= len(primaryKey); i++ {
+		schema.primaryKey = append(schema.primaryKey, primaryKey[i])
+	}
+
+	// Indexes, grouping their columns
+	rows, err = tx.QueryContext(ctx, stmtSQLiteGetTableIndexes, table.Name, namespace, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var indexColumns []string
+	var current schemaElement
+	addIndex := func() {
+		if current.name != "" {
+			current.definition += "(" + strings.Join(indexColumns, ", ") + ")"
+			schema.indexes = append(schema.indexes, current)
+		}
+	}
+	for rows.Next() {
+		var name string
+		var unique, partial bool
+		var column sql.NullString
+		if err := rows.Scan(&name, &unique, &partial, &column); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if name != current.name {
+			addIndex()
+			current, indexColumns = schemaElement{name: name}, nil
+			if unique {
+				current.definition = "UNIQUE "
+			}
+			if partial {
+				current.definition = "PARTIAL " + current.definition
+			}
+		}
+		// Columns of expression indexes have no name
+		if !column.Valid {
+			column.String = "<expression>"
+		}
+		indexColumns = append(indexColumns, column.String)
+	}
+	addIndex()
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Foreign keys have no name, they are named by their columns
+	rows, err = tx.QueryContext(ctx, stmtSQLiteGetTableForeignKeys, table.Name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	foreignKeys := make(map[int]*sqliteForeignKey)
+	var ids []int
+	for rows.Next() {
+		var id int
+		var referenced, from, onUpdate, onDelete string
+		var to sql.NullString
+		if err := rows.Scan(&id, &referenced, &from, &to, &onUpdate, &onDelete); err != nil {
+			return nil, err
+		}
+
+		fk, ok := foreignKeys[id]
+		if !ok {
+			fk = &sqliteForeignKey{table: referenced, onUpdate: onUpdate, onDelete: onDelete}
+			foreignKeys[id] = fk
+			ids = append(ids, id)
+		}
+		fk.from = append(fk.from, from)
+		// Columns referencing the primary key of the referenced table have no name
+		if to.Valid {
+			fk.to = append(fk.to, to.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		fk := foreignKeys[id]
+		referenced := fk.table
+		if len(fk.to) > 0 {
+			referenced += " (" + strings.Join(fk.to, ", ") + ")"
+		}
+		schema.foreignKeys = append(schema.foreignKeys, schemaElement{
+			name:       "(" + strings.Join(fk.from, ", ") + ")",
+			definition: fmt.Sprintf("REFERENCES %s ON UPDATE %s ON DELETE %s", referenced, fk.onUpdate, fk.onDelete),
+		})
+	}
+
+	return schema, nil
+}
+
+// createTableStatements returns the stored CREATE statement, followed by the statements creating
+// the indexes that are not created along with the table.
+func (e sqliteEngine) createTableStatements(table string, schema *tableSchema) []string {
+	if schema.view != "" {
+		return []string{schema.view}
+	}
+
+	statements := []string{schema.create}
+	for _, index := range schema.indexes {
+		if !strings.HasPrefix(index.name, sqliteAutoIndexPrefix) {
+			statements = append(statements, e.createIndexStatement(table, index))
+		}
+	}
+	return statements
+}
+
+// alterTableStatements returns the statements for the changes SQLite can apply with ALTER TABLE:
+// adding and dropping columns and indexes. Any other change needs the table to be rebuilt, which is
+// returned as a comment.
+func (e sqliteEngine) alterTableStatements(changes *tableChanges) []string {
+	alter := "ALTER TABLE " + e.quote(changes.table) + " "
+	var statements []string
+	var rebuild []string
+
+	for _, index := range changes.dropIndexes {
+		if strings.HasPrefix(index.name, sqliteAutoIndexPrefix) {
+			rebuild = append(rebuild, "index "+index.name)
+			continue
+		}
+		statements = append(statements, "DROP INDEX "+e.quote(index.name))
+	}
+	for _, column := range changes.dropColumns {
+		statements = append(statements, alter+"DROP COLUMN "+e.quote(column))
+	}
+	for _, c := range changes.columns {
+		if c.current != nil {
+			rebuild = append(rebuild, "column "+c.target.name)
+			continue
+		}
+		statements = append(statements, alter+"ADD COLUMN "+e.columnDefinition(c.target))
+	}
+	for _, index := range changes.addIndexes {
+		if strings.HasPrefix(index.name, sqliteAutoIndexPrefix) {
+			rebuild = append(rebuild, "index "+index.name)
+			continue
+		}
+		statements = append(statements, e.createIndexStatement(changes.table, index))
+	}
+
+	if changes.primaryKey {
+		rebuild = append(rebuild, "primary key")
+	}
+	for _, fk := range append(changes.addForeignKeys, changes.dropForeignKeys...) {
+		rebuild = append(rebuild, "foreign key "+fk.name)
+	}
+	for _, check := range append(changes.addChecks, changes.dropChecks...) {
+		rebuild = append(rebuild, "check "+check.name)
+	}
+	for _, option := range append(changes.setOptions, changes.resetOptions...) {
+		rebuild = append(rebuild, "option "+option.name)
+	}
+	if len(rebuild) > 0 {
+		statements = append(statements, fmt.Sprintf("-- table %s must be rebuilt to change: %s",
+			changes.table, strings.Join(uniqueStrings(rebuild), ", ")))
+	}
+
+	return statements
+}
+
+// columnDefinition returns the definition of given column, as in CREATE TABLE.
+func (e sqliteEngine) columnDefinition(c schemaColumn) string {
+	definition := []string{e.quote(c.name)}
+	if c.dataType != "" {
+		definition = append(definition, c.dataType)
+	}
+	if !c.nullable {
+		definition = append(definition, "NOT NULL")
+	}
+	if c.defaultValue != "" {
+		definition = append(definition, "DEFAULT", c.defaultValue)
+	}
+	return strings.Join(definition, " ")
+}
+
+// createIndexStatement returns the statement creating given index, whose definition is
+// "[PARTIAL ][UNIQUE ](columns)" (see getTableSchema). The condition of partial indexes is not
+// known, so they are created as full indexes.
+func (e sqliteEngine) createIndexStatement(table string, index schemaElement) string {
+	create := "CREATE INDEX "
+	definition := strings.TrimPrefix(index.definition, "PARTIAL ")
+	if strings.HasPrefix(definition, "UNIQUE ") {
+		create = "CREATE UNIQUE INDEX "
+		definition = strings.TrimPrefix(definition, "UNIQUE ")
+	}
+	return create + e.quote(index.name) + " ON " + e.quote(table) + " " + definition
+}
+
+// uniqueStrings returns given values without duplicates, keeping their order.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// parseSQLiteCreateTable returns the checks and the table options (e.g. WITHOUT ROWID) found in given
+// CREATE TABLE statement. Checks without a name are named by their expression.
+func parseSQLiteCreateTable(statement string) ([]schemaElement, []schemaElement) {
+	tokens := splitDefinition(statement)
+
+	// The columns and constraints are within the first parentheses, the options follow them
+	var body string
+	var options []schemaElement
+	for i, token := range tokens {
+		if open := strings.IndexByte(token, '('); open >= 0 {
+			body = strings.TrimSuffix(token[open+1:], ")")
+			for _, o := range strings.Split(strings.Join(tokens[i+1:], " "), ",") {
+				if o = strings.ToUpper(strings.TrimSpace(o)); o != "" {
+					options = append(options, schemaElement{name: o, definition: "true"})
+				}
+			}
+			break
+		}
+	}
+
+	var checks []schemaElement
+	bodyTokens := splitDefinition(body)
+	for i, token := range bodyTokens {
+		var expression string
+		switch {
+		case strings.EqualFold(token, "CHECK") && i+1 < len(bodyTokens):
+			expression = bodyTokens[i+1]
+		case len(token) > len("CHECK(") && strings.EqualFold(token[:len("CHECK(")], "CHECK("):
+			expression = token[len("CHECK"):]
+		default:
+			continue
+		}
+		expression = "CHECK " + strings.TrimSuffix(expression, ",")
+
+		name := expression
+		if i >= 2 && strings.EqualFold(bodyTokens[i-2], "CONSTRAINT") {
+			name = bodyTokens[i-1]
+		}
+		checks = append(checks, schemaElement{name: name, definition: expression})
+	}
+
+	return checks, options
+}
+
+// selectExpression casts every value to text, so values are returned as stored instead of being
+// converted by the driver (e.g. columns declared as DATETIME).
+func (e sqliteEngine) selectExpression(column tableColumn) string {
+	return fmt.Sprintf("CAST(%s AS TEXT)", e.quote(column.Name))
+}
+
+// orderExpression casts non numeric columns to text, as text is compared byte by byte and SQLite
+// would otherwise order values by storage class first.
+func (e sqliteEngine) orderExpression(column tableColumn) string {
+	if numericTypes[column.DataType] {
+		return e.quote(column.Name)
+	}
+	return fmt.Sprintf("CAST(%s AS TEXT)", e.quote(column.Name))
+}
+
+// checksumExpression returns the sum of the CRC32 of every row. Each value is preceded by its length,
+// so separators within values can't make different rows collide. Null values are skipped by
+// concat_ws, so whether each column is null is also part of the checksum.
+func (e sqliteEngine) checksumExpression(columns []tableColumn) string {
+	values := make([]string, 0, 2*len(columns)+1)
+	nulls := make([]string, 0, len(columns))
+	for _, c := range columns {
+		values = append(values, fmt.Sprintf("length(%s)", e.selectExpression(c)), e.selectExpression(c))
+		nulls = append(nulls, fmt.Sprintf("(%s IS NULL)", e.quote(c.Name)))
+	}
+	values = append(values, strings.Join(nulls, " || "))
+
+	return fmt.Sprintf("COALESCE(SUM(crc32(concat_ws('#', %s))), 0)", strings.Join(values, ", "))
+}
@@ -0,0 +1,520 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-db-compare/configs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestSQLite creates a SQLite database in a temporary directory, executing given statements.
+func createTestSQLite(t *testing.T, statements ...string) *configs.Database {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(sqliteDriverName, "file:"+path)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db.Close()
+
+	for _, statement := range statements {
+		_, err := db.Exec(statement)
+		assert.NoError(t, err, "error executing %s: %v", statement, err)
+	}
+
+	return &configs.Database{Label: path, Driver: engineSQLite, Path: path}
+}
+
+// openTestDatabases opens both databases of given config, returning them and the context holding the config.
+// The connections are closed when the test finishes.
+func openTestDatabases(t *testing.T, config *configs.Conf) (context.Context, *databaseConn, *databaseConn) {
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	db1, err := openDatabaseConnection(ctx, config.Database1)
+	if !assert.NoError(t, err, "error opening database: %v", err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { db1.connection.Close() })
+	db2, err := openDatabaseConnection(ctx, config.Database2)
+	if !assert.NoError(t, err, "error opening database: %v", err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { db2.connection.Close() })
+
+	return ctx, db1, db2
+}
+
+// createTestConf returns the config read from a file holding given yaml.
+func createTestConf(t *testing.T, yaml string) *configs.Conf {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configFile, []byte(yaml), 0644)
+	assert.NoError(t, err, "error writing config: %v", err)
+	config, err := configs.GetConf(configFile)
+	assert.NoError(t, err, "error creating config: %v", err)
+	return config
+}
+
+func TestCompareDatabasesSQLite(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.ChunkSize = 2
+
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(20), created DATETIME)",
+		"CREATE TABLE tags (code TEXT NOT NULL, label TEXT, UNIQUE (code))",
+		"INSERT INTO users VALUES (1, 'a', '2023-01-01 10:00:00'), (2, 'b', NULL), (10, 'c', NULL), (11, 'd', NULL)",
+		"INSERT INTO tags VALUES ('x', 'one'), ('y', 'two')")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(20), created DATETIME)",
+		"CREATE TABLE tags (code TEXT NOT NULL, label TEXT, UNIQUE (code))",
+		"CREATE INDEX tags_label ON tags (label)",
+		"INSERT INTO users VALUES (1, 'a', '2023-01-01 10:00:00'), (2, 'B', NULL), (10, 'c', NULL), (12, 'e', NULL)",
+		"INSERT INTO tags VALUES ('x', 'one'), ('y', 'two')")
+
+	for _, checksum := range []bool{false, true} {
+		config.Checksum = checksum
+		ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+		db1, err := openDatabaseConnection(ctx, config.Database1)
+		assert.NoError(t, err, "error opening database: %v", err)
+		db2, err := openDatabaseConnection(ctx, config.Database2)
+		assert.NoError(t, err, "error opening database: %v", err)
+
+		result, err := compareDatabases(ctx, db1, db2)
+		assert.NoError(t, err, "error comparing databases: %v", err)
+
+		tags := result.table("tags")
+		assert.EqualValues(t, []string{"index tags_label missing on " + config.Database1.Label}, tags.Schema)
+		assert.EqualValues(t, []string{"code"}, tags.Key)
+		assert.EqualValues(t, 0, tags.total())
+
+		users := result.table("users")
+		assert.Empty(t, users.Schema)
+		assert.EqualValues(t, []string{"id"}, users.Key)
+		assert.EqualValues(t, 4, users.Rows1)
+		assert.EqualValues(t, 4, users.Rows2)
+		assert.EqualValues(t, 1, users.OnlyIn1)
+		assert.EqualValues(t, 1, users.OnlyIn2)
+		assert.EqualValues(t, 1, users.Changed)
+
+		db1.connection.Close()
+		db2.connection.Close()
+	}
+}
+
+func TestCreateNcsvsSQLite(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO users VALUES (2, NULL), (1, 'a')")
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	db, err := openDatabaseConnection(ctx, config.Database1)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db.connection.Close()
+
+	dir := t.TempDir()
+	err = createNcsvs(ctx, db, dir)
+	assert.NoError(t, err, "error creating Ncsvs: %v", err)
+
+	content, err := os.ReadFile(ncsvPath(dir, "users"))
+	assert.NoError(t, err, "error reading Ncsv: %v", err)
+	assert.EqualValues(t, "id,name\n1,a\n2,\\N\n", string(content))
+}
+
+func TestOpenDatabaseConnectionSQLiteMissingFile(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	path := filepath.Join(t.TempDir(), "missing.db")
+	_, err = openDatabaseConnection(ctx, &configs.Database{Driver: engineSQLite, Path: path})
+	assert.Error(t, err)
+	assert.NoFileExists(t, path)
+}
+
+func TestOpenDatabaseConnectionSQLiteEscapedPath(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	// The file is only opened if neither ? nor # is taken as the start of the options, instead of
+	// a file named as the start of the path being created
+	for _, name := range []string{"test?.db", "test#1.db", "test 100%.db"} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, nil, 0644))
+
+		db, err := openDatabaseConnection(ctx, &configs.Database{Driver: engineSQLite, Path: path})
+		if assert.NoError(t, err, "error opening database %s: %v", name, err) {
+			db.connection.Close()
+		}
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err, "error reading dir: %v", err)
+		if assert.Len(t, entries, 1, name) {
+			assert.EqualValues(t, name, entries[0].Name())
+		}
+	}
+}
+
+func TestCompareDatabasesSQLiteDataOnly(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.DataOnly = true
+
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE Users (Id INTEGER PRIMARY KEY, Name TEXT, Created DATETIME)",
+		"INSERT INTO Users VALUES (1, 'a', '2023-01-01 10:00:00'), (2, 'b', '2023-01-02 10:00:00.5')")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE users (created TIMESTAMP, id BIGINT PRIMARY KEY, name VARCHAR(20))",
+		"INSERT INTO users VALUES ('2023-01-01T10:00:00.000', 1, 'a'), ('2023-01-02 10:00:00.500', 2, 'c')")
+	ctx, db1, db2 := openTestDatabases(t, config)
+
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	assert.Empty(t, result.Problems)
+	assert.Len(t, result.Tables, 1)
+	users := result.Tables[0]
+	assert.Empty(t, users.Schema)
+	assert.EqualValues(t, []string{"Id"}, users.Key)
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("Id", "2"), Values: []valueDifference{{Column: "Name", Value1: strPtr("b"), Value2: strPtr("c")}}},
+	}, users.Rows)
+}
+
+func TestGetTableSchemaSQLite(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	createProducts := "CREATE TABLE products (id INTEGER NOT NULL, code TEXT DEFAULT 'x', category_id INTEGER REFERENCES categories ON DELETE CASCADE, " +
+		"price DECIMAL(10,2) CONSTRAINT chk_price CHECK (price > 0), PRIMARY KEY (code, id), UNIQUE (price, code)) WITHOUT ROWID"
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE categories (id INTEGER PRIMARY KEY)",
+		createProducts,
+		"CREATE INDEX idx_category ON products (category_id)")
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	db, err := openDatabaseConnection(ctx, config.Database1)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db.connection.Close()
+	db.tx, err = db.connection.BeginTx(ctx, &sql.TxOptions{})
+	assert.NoError(t, err, "error creating database transaction: %v", err)
+
+	schema, err := db.engine.getTableSchema(ctx, db.tx, db.namespace(), fullTable{Name: "products", Type: tableTypeBaseTable})
+	assert.NoError(t, err, "error getting schema: %v", err)
+	assert.EqualValues(t, &tableSchema{
+		columns: []schemaColumn{
+			{name: "id", dataType: "INTEGER"},
+			{name: "code", dataType: "TEXT", defaultValue: "'x'"},
+			{name: "category_id", dataType: "INTEGER", nullable: true},
+			{name: "price", dataType: "DECIMAL(10,2)", nullable: true},
+		},
+		primaryKey: []string{"code", "id"},
+		indexes: []schemaElement{
+			{name: "idx_category", definition: "(category_id)"},
+			{name: "sqlite_autoindex_products_2", definition: "UNIQUE (price, code)"},
+		},
+		foreignKeys: []schemaElement{{name: "(category_id)", definition: "REFERENCES categories ON UPDATE NO ACTION ON DELETE CASCADE"}},
+		checks:      []schemaElement{{name: "chk_price", definition: "CHECK (price > 0)"}},
+		options:     []schemaElement{{name: "WITHOUT ROWID", definition: "true"}},
+		create:      createProducts,
+	}, schema)
+}
+
+func TestCompareDatabasesSQLiteFilter(t *testing.T) {
+	config := createTestConf(t, "chunk_size: 2\nwhere: tenant = 1\ntable_filters:\n  - table_name: tenants\n    where: ''\n")
+
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, tenant INTEGER, total INTEGER)",
+		"CREATE TABLE tenants (tenant INTEGER PRIMARY KEY)",
+		"INSERT INTO orders VALUES (1, 1, 10), (2, 2, 20), (3, 1, 30), (4, 1, 40)",
+		"INSERT INTO tenants VALUES (1), (2)")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, tenant INTEGER, total INTEGER)",
+		"CREATE TABLE tenants (tenant INTEGER PRIMARY KEY)",
+		"INSERT INTO orders VALUES (1, 1, 10), (2, 2, 99), (3, 1, 31), (4, 1, 40), (5, 2, 50)",
+		"INSERT INTO tenants VALUES (1), (2), (3)")
+
+	for _, checksum := range []bool{false, true} {
+		config.Checksum = checksum
+		ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+		db1, err := openDatabaseConnection(ctx, config.Database1)
+		assert.NoError(t, err, "error opening database: %v", err)
+		db2, err := openDatabaseConnection(ctx, config.Database2)
+		assert.NoError(t, err, "error opening database: %v", err)
+
+		result, err := compareDatabases(ctx, db1, db2)
+		assert.NoError(t, err, "error comparing databases: %v", err)
+
+		// Only the orders of tenant 1 are compared, every tenant is compared
+		orders := result.table("orders")
+		assert.EqualValues(t, "tenant = 1", orders.Filter)
+		assert.EqualValues(t, 3, orders.Rows1)
+		assert.EqualValues(t, 3, orders.Rows2)
+		assert.EqualValues(t, []rowDifference{
+			{Type: rowChanged, Key: testKey("id", "3"), Values: []valueDifference{{Column: "total", Value1: strPtr("30"), Value2: strPtr("31")}}},
+		}, orders.Rows)
+
+		tenants := result.table("tenants")
+		assert.Empty(t, tenants.Filter)
+		assert.EqualValues(t, 1, tenants.OnlyIn2)
+
+		db1.connection.Close()
+		db2.connection.Close()
+	}
+}
+
+func TestCompareDatabasesSQLiteMappings(t *testing.T) {
+	config := createTestConf(t, `
+table_mappings:
+  - table_name: clients
+    table_name2: customers
+column_mappings:
+  - table_name: clients
+    column: name
+    column2: full_name
+ignore_table_columns:
+  - table_name: clients
+    columns:
+      - updated
+table_filters:
+  - table_name: clients
+    where: name <> 'z'
+    where2: full_name <> 'z'
+`)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE clients (id INTEGER PRIMARY KEY, name TEXT, updated TEXT)",
+		"CREATE TABLE old (id INTEGER)",
+		"INSERT INTO clients VALUES (1, 'a', 'x'), (2, 'b', 'x')")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE customers (id INTEGER PRIMARY KEY, full_name TEXT, updated TEXT)",
+		"CREATE TABLE new (id INTEGER)",
+		"INSERT INTO customers VALUES (1, 'a', 'y'), (2, 'c', 'y'), (3, 'z', 'y')")
+	ctx, db1, db2 := openTestDatabases(t, config)
+
+	changes := &syncChanges{}
+	db2.patch = &dataPatch{engine: db2.engine, out: changes}
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	// Renamed tables and columns are paired, the rest are only in one of the databases
+	assert.EqualValues(t, []string{"old"}, result.TablesOnlyIn1)
+	assert.EqualValues(t, []string{"new"}, result.TablesOnlyIn2)
+
+	// Each database is filtered with the condition using its own column names
+	clients := result.table("clients")
+	assert.EqualValues(t, "name <> 'z'", clients.Filter)
+	assert.Empty(t, clients.Schema)
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("id", "2"), Values: []valueDifference{{Column: "name", Value1: strPtr("b"), Value2: strPtr("c")}}},
+	}, clients.Rows)
+
+	// Rows of database2 are fixed with its own names
+	assert.EqualValues(t, []string{`UPDATE "customers" SET "full_name" = 'b' WHERE "id" = '2'`}, changes.statements)
+}
+
+func TestCompareDatabasesSQLiteMissingTables(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+
+	// The extra table of database2 would shift b and c if tables were paired by position
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE a (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE b (id INTEGER PRIMARY KEY, name TEXT)",
+		"CREATE TABLE c (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE d (id INTEGER PRIMARY KEY)",
+		"INSERT INTO b VALUES (1, 'x'), (2, 'y')",
+		"INSERT INTO c VALUES (1)")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE a (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE aa (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE b (id INTEGER PRIMARY KEY, name TEXT)",
+		"CREATE TABLE c (id INTEGER PRIMARY KEY)",
+		"INSERT INTO b VALUES (1, 'x'), (2, 'z')",
+		"INSERT INTO c VALUES (1), (2)")
+	ctx, db1, db2 := openTestDatabases(t, config)
+
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	assert.EqualValues(t, []string{"d"}, result.TablesOnlyIn1)
+	assert.EqualValues(t, []string{"aa"}, result.TablesOnlyIn2)
+	assert.Empty(t, result.Problems)
+
+	b := result.table("b")
+	assert.Empty(t, b.Schema)
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("id", "2"), Values: []valueDifference{{Column: "name", Value1: strPtr("y"), Value2: strPtr("z")}}},
+	}, b.Rows)
+
+	c := result.table("c")
+	assert.Empty(t, c.Schema)
+	assert.EqualValues(t, []rowDifference{{Type: rowOnlyIn2, Key: testKey("id", "2")}}, c.Rows)
+}
+
+func TestCompareDatabasesSQLiteNullableKey(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+
+	// Null values are not unique, so rows with a null email would be paired by position if it was the key
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE contacts (email TEXT UNIQUE, name TEXT)",
+		"CREATE TABLE codes (email TEXT UNIQUE, code TEXT NOT NULL UNIQUE)",
+		"INSERT INTO contacts VALUES (NULL, 'a'), (NULL, 'b'), ('x', 'c')",
+		"INSERT INTO codes VALUES (NULL, 'a'), (NULL, 'b')")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE contacts (email TEXT UNIQUE, name TEXT)",
+		"CREATE TABLE codes (email TEXT UNIQUE, code TEXT NOT NULL UNIQUE)",
+		"INSERT INTO contacts VALUES ('x', 'c'), (NULL, 'b'), (NULL, 'a')",
+		"INSERT INTO codes VALUES (NULL, 'b'), (NULL, 'a')")
+	ctx, db1, db2 := openTestDatabases(t, config)
+
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	contacts := result.table("contacts")
+	assert.Nil(t, contacts.Key)
+	assert.EqualValues(t, 3, contacts.Rows1)
+	assert.EqualValues(t, 0, contacts.total())
+
+	codes := result.table("codes")
+	assert.EqualValues(t, []string{"code"}, codes.Key)
+	assert.EqualValues(t, 0, codes.total())
+}
+
+func TestCompareDatabasesSQLiteTolerance(t *testing.T) {
+	config := createTestConf(t, `
+tolerance:
+  absolute: 0.001
+column_tolerances:
+  - table_name: metrics
+    column: ratio
+    relative: 0.01
+`)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE metrics (id INTEGER PRIMARY KEY, value REAL, ratio DOUBLE, label TEXT)",
+		"INSERT INTO metrics VALUES (1, 1.5, 100, 'a'), (2, 1.5, 100, 'a'), (3, 2.5, NULL, 'a')")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE metrics (id INTEGER PRIMARY KEY, value REAL, ratio DOUBLE, label TEXT)",
+		"INSERT INTO metrics VALUES (1, 1.5004, 100.5, 'a'), (2, 1.75, 102, 'a'), (3, 2.5004, 0, 'b')")
+	ctx, db1, db2 := openTestDatabases(t, config)
+
+	changes := &syncChanges{}
+	db2.patch = &dataPatch{engine: db2.engine, out: changes}
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	// Values within tolerance are the same, null values never are
+	metrics := result.table("metrics")
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("id", "2"), Values: []valueDifference{
+			{Column: "value", Value1: strPtr("1.5"), Value2: strPtr("1.75")},
+			{Column: "ratio", Value1: strPtr("100.0"), Value2: strPtr("102.0")},
+		}},
+		{Type: rowChanged, Key: testKey("id", "3"), Values: []valueDifference{
+			{Column: "ratio", Value1: nil, Value2: strPtr("0.0")},
+			{Column: "label", Value1: strPtr("a"), Value2: strPtr("b")},
+		}},
+	}, metrics.Rows)
+
+	// Only the columns out of tolerance are fixed
+	assert.EqualValues(t, []string{
+		`UPDATE "metrics" SET "value" = '1.5', "ratio" = '100.0' WHERE "id" = '2'`,
+		`UPDATE "metrics" SET "ratio" = NULL, "label" = 'a' WHERE "id" = '3'`,
+	}, changes.statements)
+}
+
+func TestCompareDatabasesSQLiteTimeTolerance(t *testing.T) {
+	config := createTestConf(t, `
+tolerance:
+  time: 2s
+column_tolerances:
+  - table_name: events
+    column: created
+    time: 5s
+`)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE events (id INTEGER PRIMARY KEY, created DATETIME, updated TIMESTAMP, day DATE)",
+		"INSERT INTO events VALUES (1, '2023-01-01 10:00:00', '2023-01-01 12:00:00+02:00', '2023-01-01'),"+
+			" (2, '2023-01-01 10:00:00', '2023-01-01 10:00:00', '2023-01-01')")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE events (id INTEGER PRIMARY KEY, created DATETIME, updated TIMESTAMP, day DATE)",
+		"INSERT INTO events VALUES (1, '2023-01-01T10:00:01.5', '2023-01-01 10:00:00Z', '2023-01-01'),"+
+			" (2, '2023-01-01 10:00:03', 'never', '2023-01-02')")
+	ctx, db1, db2 := openTestDatabases(t, config)
+
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	// Times at most 2s apart (5s for created) are the same, also when rendered in different time zones
+	events := result.table("events")
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("id", "2"), Values: []valueDifference{
+			{Column: "updated", Value1: strPtr("2023-01-01 10:00:00"), Value2: strPtr("never")},
+			{Column: "day", Value1: strPtr("2023-01-01"), Value2: strPtr("2023-01-02")},
+		}},
+	}, events.Rows)
+}
+
+func TestCompareDatabasesSQLiteJSON(t *testing.T) {
+	config := createTestConf(t, `
+ignore_json_paths:
+  - table_name: events
+    column: payload
+    paths:
+      - $.updated_at
+`)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE events (id INTEGER PRIMARY KEY, payload JSON, raw TEXT)",
+		`INSERT INTO events VALUES (1, '{"a": 1, "b": [1, 2], "updated_at": "2023"}', '{"a": 1}'),`+
+			` (2, '{"a": 1}', '{"a": 1}')`)
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE events (id INTEGER PRIMARY KEY, payload JSON, raw TEXT)",
+		`INSERT INTO events VALUES (1, '{"b":[1,2],"a":1.0,"updated_at":"2024"}', '{"a": 1}'),`+
+			` (2, '{"a": 2}', '{"a":1}')`)
+	ctx, db1, db2 := openTestDatabases(t, config)
+
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	// JSON columns are compared as documents, the rest of columns as strings
+	events := result.table("events")
+	assert.EqualValues(t, []rowDifference{
+		{Type: rowChanged, Key: testKey("id", "2"), Values: []valueDifference{
+			{Column: "payload", Value1: strPtr(`{"a": 1}`), Value2: strPtr(`{"a": 2}`)},
+			{Column: "raw", Value1: strPtr(`{"a": 1}`), Value2: strPtr(`{"a":1}`)},
+		}},
+	}, events.Rows)
+}
+
+func TestCompareDatabasesSQLiteUsageErrors(t *testing.T) {
+	// Settings that can only be checked once the tables are read are usage errors too
+	for _, yaml := range []string{`
+ignore_table_columns:
+  - table_name: events
+    columns:
+      - code
+table_keys:
+  - table_name: events
+    columns:
+      - code
+`, `
+ignore_json_paths:
+  - table_name: events
+    column: payload
+    paths:
+      - updated_at
+`} {
+		config := createTestConf(t, yaml)
+		config.Database1 = createTestSQLite(t, "CREATE TABLE events (id INTEGER PRIMARY KEY, code TEXT, payload JSON)")
+		config.Database2 = createTestSQLite(t, "CREATE TABLE events (id INTEGER PRIMARY KEY, code TEXT, payload JSON)")
+		ctx, db1, db2 := openTestDatabases(t, config)
+
+		_, err := compareDatabases(ctx, db1, db2)
+		assert.True(t, errors.Is(err, ErrUsage), "expected usage error, got %v: %s", err, yaml)
+	}
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go-db-compare/configs"
 )
@@ -10,30 +11,52 @@ type contextKey string
 
 const (
 	// List of available strategies
-	strategyDumps1 = "dump"
-	strategyDumps2 = "twodumps"
-	strategyLive   = "live"
-	strategyDiff   = "diff"
+	strategyDumps1   = "dump"
+	strategyDumps2   = "twodumps"
+	strategyLive     = "live"
+	strategyDiff     = "diff"
+	strategySync     = "sync"
+	strategyLiveDump = "livedump"
 
 	// List of keys to use when storing values in the context
 	contextKeyConfig contextKey = "config"
 )
 
 var (
+	// ErrDifferencesFound is returned by RunCompare when the databases being compared are not the same.
+	ErrDifferencesFound = errors.New("differences found")
+	// ErrUsage is wrapped by the errors returned by RunCompare when the given strategy or config are not valid.
+	ErrUsage = errors.New("usage error")
+
 	// strategies is a map containing the valid strategies. Used for strategy validation.
 	strategies = map[string]bool{
-		strategyDumps1: true,
-		strategyDumps2: true,
-		strategyLive:   true,
-		strategyDiff:   true,
+		strategyDumps1:   true,
+		strategyDumps2:   true,
+		strategyLive:     true,
+		strategyDiff:     true,
+		strategySync:     true,
+		strategyLiveDump: true,
 	}
 )
 
 // RunCompare is responsible for running the process according to given strategy.
+//
+// ErrDifferencesFound is returned if differences were found. If the given strategy or config
+// are not valid, the returned error wraps ErrUsage.
 func RunCompare(config *configs.Conf, strategy string) error {
 	// Validate given strategy
 	if !isValidStrategy(strategy) {
-		return fmt.Errorf("strategy not valid")
+		return fmt.Errorf("%w: strategy not valid", ErrUsage)
+	}
+
+	// Validate given output
+	if !isValidOutput(config.GetOutput()) {
+		return fmt.Errorf("%w: output not valid", ErrUsage)
+	}
+
+	// Validate given config
+	if err := validateConfig(config, strategy); err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
 	}
 
 	// Initiate context with given config
@@ -50,6 +73,10 @@ func RunCompare(config *configs.Conf, strategy string) error {
 		err = runStrategyLive(ctx)
 	case strategyDiff:
 		err = runStrategyDiff(ctx)
+	case strategySync:
+		err = runStrategySync(ctx)
+	case strategyLiveDump:
+		err = runStrategyLiveDump(ctx)
 	}
 
 	if err != nil {
@@ -64,6 +91,30 @@ func isValidStrategy(s string) bool {
 	return strategies[s]
 }
 
+// validateConfig returns an error if the config is missing anything needed by given strategy.
+func validateConfig(config *configs.Conf, strategy string) error {
+	needsDatabase1 := strategy == strategyDumps1 || strategy == strategyDumps2 || strategy == strategyLive || strategy == strategySync ||
+		strategy == strategyLiveDump
+	needsDatabase2 := strategy == strategyDumps2 || strategy == strategyLive || strategy == strategySync
+	needsDir := strategy == strategyDumps1 || strategy == strategyDumps2 || strategy == strategyDiff
+	needsDir2 := strategy == strategyDumps2 || strategy == strategyDiff || strategy == strategyLiveDump
+
+	switch {
+	case needsDatabase1 && config.Database1 == nil:
+		return fmt.Errorf("database is missing in config")
+	case needsDatabase2 && config.Database2 == nil:
+		return fmt.Errorf("database2 is missing in config")
+	case needsDir && config.Dir == "":
+		return fmt.Errorf("dir is missing in config")
+	case needsDir2 && config.Dir2 == "":
+		return fmt.Errorf("dir2 is missing in config")
+	case (config.GetOutput() == outputSchemaDiff || config.GetOutput() == outputDataDiff) && strategy != strategyLive:
+		return fmt.Errorf("output %s is only available for strategy %s", config.GetOutput(), strategyLive)
+	}
+
+	return nil
+}
+
 // getConfigFromContext returns the Conf existing in the given context.
 func getConfigFromContext(ctx context.Context) *configs.Conf {
 	return ctx.Value(contextKeyConfig).(*configs.Conf)
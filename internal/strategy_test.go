@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"errors"
+	"go-db-compare/configs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCompareUsageErrors(t *testing.T) {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+
+	err = RunCompare(config, "unknown")
+	assert.True(t, errors.Is(err, ErrUsage), "expected usage error, got %v", err)
+
+	config.Output = "xml"
+	err = RunCompare(config, strategyLive)
+	assert.True(t, errors.Is(err, ErrUsage), "expected usage error, got %v", err)
+
+	config.Output = outputText
+	config.Database2 = nil
+	err = RunCompare(config, strategyLive)
+	assert.True(t, errors.Is(err, ErrUsage), "expected usage error, got %v", err)
+
+	config.Output = outputSchemaDiff
+	err = RunCompare(config, strategyDiff)
+	assert.True(t, errors.Is(err, ErrUsage), "expected usage error, got %v", err)
+
+	config.Output = outputDataDiff
+	err = RunCompare(config, strategyDiff)
+	assert.True(t, errors.Is(err, ErrUsage), "expected usage error, got %v", err)
+
+	config.Output = outputText
+	config.Dir2 = "/nonexistent/dir"
+	err = RunCompare(config, strategyDiff)
+	assert.True(t, errors.Is(err, ErrUsage), "expected usage error, got %v", err)
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// syncChanges collects the statements fixing the rows of database2 (see dataPatch), so they can be
+// applied once both databases are compared. It implements patchWriter.
+type syncChanges struct {
+	// maxChanges holds the number of statements after which the sync is aborted, 0 if there is no limit.
+	maxChanges int
+
+	statements []string
+	// comments holds the changes that can't be made by a statement.
+	comments []string
+}
+
+func (c *syncChanges) statement(statement string) error {
+	if c.maxChanges > 0 && len(c.statements) >= c.maxChanges {
+		return fmt.Errorf("more than %d rows would change, aborting sync", c.maxChanges)
+	}
+	c.statements = append(c.statements, statement)
+	return nil
+}
+
+func (c *syncChanges) comment(text string) error {
+	c.comments = append(c.comments, text)
+	return nil
+}
+
+// runStrategySync compares both databases as runStrategyLive does, and applies to database2 the
+// statements fixing its rows so that its data matches the data of database1.
+//
+// Changes are only applied when configured with SyncApply (dry run by default), after being confirmed
+// unless configured with SyncAssumeYes. They are applied in the transaction used to compare database2,
+// so either all of them or none are applied.
+func runStrategySync(ctx context.Context) error {
+	config := getConfigFromContext(ctx)
+	// Connect to databases
+	database1, err := openDatabaseConnection(ctx, config.Database1)
+	if err != nil {
+		return err
+	}
+	defer database1.connection.Close()
+	database2, err := openWritableDatabaseConnection(ctx, config.Database2)
+	if err != nil {
+		return err
+	}
+	defer database2.connection.Close()
+
+	// Rows can only be fixed with the values read from database1 if they are not normalized
+	if isDataOnly(ctx, database1, database2) {
+		return fmt.Errorf("%w: strategy %s needs both databases to be of the same engine and data_only to be false",
+			ErrUsage, strategySync)
+	}
+
+	// Compare databases, collecting the statements fixing the rows of database2
+	changes := &syncChanges{maxChanges: config.SyncMaxChanges}
+	database2.patch = &dataPatch{engine: database2.engine, out: changes}
+	result, err := compareDatabases(ctx, database1, database2)
+	// Nothing is written to database2 unless the changes are applied, and the transactions must be
+	// finished before closing the connections. Rolling back a committed transaction has no effect.
+	defer func() {
+		if database1.tx != nil {
+			database1.tx.Rollback()
+		}
+		if database2.tx != nil {
+			database2.tx.Rollback()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	// Show every difference found
+	if err := result.write(os.Stdout, config.GetOutput(), config.Detailed); err != nil {
+		return err
+	}
+
+	// The statements, the confirmation and the progress go to stderr, so stdout only holds the report
+	// and stays parseable with json output
+	applied, err := applyChanges(ctx, database2, changes, os.Stdin, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("sync error: %v", err)
+	}
+
+	// Differences remain unless every one of them was fixed
+	if result.hasDifferences() && (!applied || len(changes.comments) > 0 || result.hasSchemaDifferences()) {
+		return ErrDifferencesFound
+	}
+
+	return nil
+}
+
+// applyChanges applies given changes to db in its transaction, sending them in batches of the configured size,
+// and returns whether they were applied. If not configured with SyncApply, the changes are only written to out.
+// Unless configured with SyncAssumeYes, the changes are only applied if confirmed by reading "y" from in.
+// Every message, including the confirmation prompt, is written to out.
+func applyChanges(ctx context.Context, db *databaseConn, changes *syncChanges, in io.Reader, out io.Writer) (bool, error) {
+	config := getConfigFromContext(ctx)
+
+	for _, c := range changes.comments {
+		fmt.Fprintf(out, "not synced: %s\n", c)
+	}
+	if len(changes.statements) == 0 {
+		fmt.Fprintf(out, "no rows to sync in %s\n", config.Database2.Label)
+		return false, nil
+	}
+
+	if !config.SyncApply {
+		for _, statement := range changes.statements {
+			fmt.Fprintf(out, "%s;\n", statement)
+		}
+		fmt.Fprintf(out, "dry run: %d changes not applied to %s, use -apply to apply them\n", len(changes.statements), config.Database2.Label)
+		return false, nil
+	}
+
+	if !config.SyncAssumeYes {
+		fmt.Fprintf(out, "apply %d changes to %s? [y/N] ", len(changes.statements), config.Database2.Label)
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Fprintln(out, "sync cancelled")
+			return false, nil
+		}
+	}
+
+	batchSize := config.GetSyncBatchSize()
+	for i := 0; i < len(changes.statements); i += batchSize {
+		end := i + batchSize
+		if end > len(changes.statements) {
+			end = len(changes.statements)
+		}
+		if _, err := db.tx.ExecContext(ctx, strings.Join(changes.statements[i:end], ";\n")); err != nil {
+			db.tx.Rollback()
+			return false, err
+		}
+	}
+	if err := db.tx.Commit(); err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(out, "%d changes applied to %s\n", len(changes.statements), config.Database2.Label)
+	return true, nil
+}
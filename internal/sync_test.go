@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"go-db-compare/configs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestSyncDatabases returns a config comparing two SQLite databases whose users differ in 3 rows.
+func createTestSyncDatabases(t *testing.T) *configs.Conf {
+	config, err := configs.GetConf("../config.yaml")
+	assert.NoError(t, err, "error creating config: %v", err)
+	config.Database1 = createTestSQLite(t,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO users VALUES (1, 'a'), (2, 'b'), (3, 'c')")
+	config.Database2 = createTestSQLite(t,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO users VALUES (1, 'a'), (2, 'x'), (4, 'd')")
+	return config
+}
+
+// syncTestDatabases compares the databases of given config and applies the changes, answering the confirmation with answer.
+// Returns the output of applyChanges and the differences found when comparing the databases again.
+func syncTestDatabases(t *testing.T, config *configs.Conf, answer string) (string, *comparisonResult) {
+	ctx := context.WithValue(context.Background(), contextKeyConfig, config)
+
+	db1, err := openDatabaseConnection(ctx, config.Database1)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db1.connection.Close()
+	db2, err := openDatabaseConnection(ctx, config.Database2)
+	assert.NoError(t, err, "error opening database: %v", err)
+	defer db2.connection.Close()
+
+	changes := &syncChanges{maxChanges: config.SyncMaxChanges}
+	db2.patch = &dataPatch{engine: db2.engine, out: changes}
+	_, err = compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+
+	var out bytes.Buffer
+	_, err = applyChanges(ctx, db2, changes, strings.NewReader(answer), &out)
+	assert.NoError(t, err, "error applying changes: %v", err)
+	db1.tx.Rollback()
+	db2.tx.Rollback()
+
+	db2.patch = nil
+	result, err := compareDatabases(ctx, db1, db2)
+	assert.NoError(t, err, "error comparing databases: %v", err)
+	return out.String(), result
+}
+
+func TestApplyChangesDryRun(t *testing.T) {
+	config := createTestSyncDatabases(t)
+
+	out, result := syncTestDatabases(t, config, "")
+	assert.Contains(t, out, "UPDATE \"users\" SET \"name\" = 'b' WHERE \"id\" = '2';\n")
+	assert.Contains(t, out, "dry run: 3 changes not applied")
+	assert.EqualValues(t, 3, result.table("users").total())
+}
+
+func TestApplyChangesCancelled(t *testing.T) {
+	config := createTestSyncDatabases(t)
+	config.SyncApply = true
+
+	out, result := syncTestDatabases(t, config, "n\n")
+	assert.Contains(t, out, "sync cancelled")
+	assert.EqualValues(t, 3, result.table("users").total())
+}
+
+func TestApplyChanges(t *testing.T) {
+	for _, assumeYes := range []bool{false, true} {
+		config := createTestSyncDatabases(t)
+		config.SyncApply = true
+		config.SyncAssumeYes = assumeYes
+		config.SyncBatchSize = 2
+
+		out, result := syncTestDatabases(t, config, "y\n")
+		assert.Contains(t, out, "3 changes applied")
+		assert.False(t, result.hasDifferences())
+	}
+}
+
+func TestSyncMaxChanges(t *testing.T) {
+	config := createTestSyncDatabases(t)
+	config.SyncMaxChanges = 2
+	config.SyncApply = true
+	config.SyncAssumeYes = true
+
+	err := RunCompare(config, strategySync)
+	assert.ErrorContains(t, err, "more than 2 rows would change")
+
+	config.SyncMaxChanges = 3
+	err = RunCompare(config, strategySync)
+	assert.NoError(t, err)
+}
+
+func TestDataSourceNameMySQLMultiStatements(t *testing.T) {
+	dbConfig := &configs.Database{Username: "user", Password: "pass", Host: "localhost", Port: "3306", Database: "db"}
+
+	// Only the connection the statements are applied through sends them in batches
+	assert.Contains(t, mysqlEngine{}.dataSourceName(dbConfig, true), "multiStatements=true")
+	assert.NotContains(t, mysqlEngine{}.dataSourceName(dbConfig, false), "multiStatements")
+}
@@ -1,29 +1,68 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"go-db-compare/configs"
 	"go-db-compare/internal"
 	"log"
+	"os"
+)
+
+// List of exit codes
+const (
+	exitIdentical   = 0 // no differences found
+	exitDifferences = 1 // differences found
+	exitUsage       = 2 // arguments or config not valid
+	exitRuntime     = 3 // any other error (e.g. connecting to a database)
 )
 
 func main() {
-	if err := run(); err != nil {
-		log.Fatal(err)
+	err := run()
+	if err != nil && !errors.Is(err, internal.ErrDifferencesFound) {
+		log.Print(err)
+	}
+	os.Exit(exitCode(err))
+}
+
+// exitCode returns the exit code for the given error returned by run.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitIdentical
+	case errors.Is(err, internal.ErrDifferencesFound):
+		return exitDifferences
+	case errors.Is(err, internal.ErrUsage):
+		return exitUsage
+	default:
+		return exitRuntime
 	}
 }
 
 func run() error {
-	// Parse command line flags: config and strategy
+	// Parse command line flags: config, strategy, output and the sync options
 	configFile := flag.String("c", "", "path to config file (e.g. config.yaml)")
-	strategy := flag.String("s", "", "strategy [dump, twodumps, live, diff]")
+	strategy := flag.String("s", "", "strategy [dump, twodumps, live, diff, sync, livedump]")
+	output := flag.String("o", "", "output [text, json, schemadiff, datadiff] (overrides the output in the config file)")
+	apply := flag.Bool("apply", false, "apply the changes of strategy sync (dry run otherwise)")
+	yes := flag.Bool("yes", false, "apply the changes of strategy sync without asking for confirmation")
+	maxChanges := flag.Int("max-changes", 0, "abort strategy sync if more rows would change (overrides sync_max_changes in the config file)")
 	flag.Parse()
 
 	// Get config
 	conf, err := configs.GetConf(*configFile)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", internal.ErrUsage, err)
+	}
+	if *output != "" {
+		conf.Output = *output
+	}
+	if *maxChanges > 0 {
+		conf.SyncMaxChanges = *maxChanges
 	}
+	conf.SyncApply = *apply
+	conf.SyncAssumeYes = *yes
 
 	// Run
 	if err := internal.RunCompare(conf, *strategy); err != nil {